@@ -2,28 +2,158 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/patch"
 )
 
 var _ adk.Agent = (*Agent[any])(nil)
 
+// SessionEndPolicy decides what happens to the stored state and history once the form
+// reaches a terminal phase.
+type SessionEndPolicy string
+
+const (
+	// SessionEndKeep leaves state and history in place.
+	SessionEndKeep SessionEndPolicy = "keep"
+	// SessionEndClear deletes state and history so the next message starts a new form.
+	SessionEndClear SessionEndPolicy = "clear"
+	// SessionEndArchive hands state and history to the Archiver, then clears them.
+	SessionEndArchive SessionEndPolicy = "archive"
+)
+
+// Archiver stores finished sessions before they are cleared.
+type Archiver[T any] interface {
+	Archive(ctx context.Context, state *State[T], history []*schema.Message) error
+}
+
+type ArchiverFunc[T any] func(ctx context.Context, state *State[T], history []*schema.Message) error
+
+func (f ArchiverFunc[T]) Archive(ctx context.Context, state *State[T], history []*schema.Message) error {
+	return f(ctx, state, history)
+}
+
 type Agent[T any] struct {
 	name        string
 	description string
 	flow        *FormFlow[T]
 	store       StateReadWriter[T]
+	history     HistoryReadWriter
+	endPolicy   SessionEndPolicy
+	archiver    Archiver[T]
+
+	transactional   bool
+	rollbackOnError bool
+	formEvents      bool
+	conflictRetries int
+	locker          SessionLocker
+	lockKey         KeyGen
+	stateInit       func(ctx context.Context) T
+}
+
+// turn carries what a run still has to persist once the reply is delivered.
+type turn[T any] struct {
+	state *State[T]
+	// pending holds incoming messages not yet written to the history store.
+	pending []*schema.Message
+	// release unlocks the session taken by WithSessionLocker.
+	release func()
+}
+
+type AgentOption[T any] func(*Agent[T])
+
+// WithHistory makes Run load the chat history from history, append the incoming
+// messages and the assistant reply to it, and pass the whole history to the flow. The
+// caller then only sends the new messages.
+func WithHistory[T any](history HistoryReadWriter) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.history = history
+	}
+}
+
+// WithSessionEndPolicy sets what Run does after a turn ends in a terminal phase. The
+// default is SessionEndKeep.
+func WithSessionEndPolicy[T any](policy SessionEndPolicy) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.endPolicy = policy
+	}
+}
+
+// WithArchiver archives finished sessions and selects SessionEndArchive.
+func WithArchiver[T any](archiver Archiver[T]) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.archiver = archiver
+		a.endPolicy = SessionEndArchive
+	}
+}
+
+// WithTransactionalStream defers saving the state of a streamed turn, and writing its
+// messages to history, until the reply stream has been read to the end. If the stream
+// fails, the reader closes it early or the context of Run is cancelled, the turn is
+// rolled back when rollbackOnError is set; otherwise the state and the incoming messages are saved without the reply.
+func WithTransactionalStream[T any](rollbackOnError bool) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.transactional = true
+		a.rollbackOnError = rollbackOnError
+	}
+}
+
+// WithConflictRetry applies the patch of an edit turn again to the newly stored state,
+// up to retries times, when the state was saved by another turn in the meantime. The
+// model is not called again. Without it, and for turns that submitted the form or
+// undid, redid or reset it, such a turn fails with a ConflictError. Transactional
+// streams save after the reply has been sent and are never retried.
+func WithConflictRetry[T any](retries int) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.conflictRetries = retries
+	}
+}
+
+// WithSessionLocker makes turns of the same session, as identified by keygen, take the
+// session lock from locker before loading the state. A streamed turn holds the lock
+// until its reply has been read to the end or closed, or the context of Run is
+// cancelled.
+func WithSessionLocker[T any](locker SessionLocker, keygen KeyGen) AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.locker = locker
+		a.lockKey = keygen
+	}
 }
 
-func NewAgent[T any](name, description string, flow *FormFlow[T], store StateReadWriter[T]) *Agent[T] {
-	return &Agent[T]{
+// WithSerializedTurns queues turns of the same session in process. It is
+// WithSessionLocker with a MemorySessionLocker without a queue limit.
+func WithSerializedTurns[T any](keygen KeyGen) AgentOption[T] {
+	return WithSessionLocker[T](NewMemorySessionLocker(0), keygen)
+}
+
+// NewAgent creates an agent that runs flow against the state kept in store. When the
+// flow has no StateInit and store implements StateInitializer, the store's initial
+// state is used to reset the form. The flow is not modified and may be shared.
+func NewAgent[T any](name, description string, flow *FormFlow[T], store StateReadWriter[T], opts ...AgentOption[T]) *Agent[T] {
+	a := &Agent[T]{
 		name:        name,
 		description: description,
 		flow:        flow,
 		store:       store,
+		endPolicy:   SessionEndKeep,
+	}
+	if initializer, ok := store.(StateInitializer[T]); ok {
+		a.stateInit = func(ctx context.Context) T {
+			return initializer.InitState(ctx).FormState
+		}
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *Agent[T]) Name(ctx context.Context) string {
@@ -51,28 +181,46 @@ func (a *Agent[T]) Run(ctx context.Context, input *adk.AgentInput, options ...ad
 			})
 			return
 		}
-		state, err := a.store.Load(ctx)
+		release, err := a.lockTurn(ctx)
 		if err != nil {
-			gen.Send(&adk.AgentEvent{
-				Err: fmt.Errorf("failed to load session: %w", err),
-			})
+			gen.Send(&adk.AgentEvent{Err: err})
 			return
 		}
-		req := &Request[T]{
-			State:       state,
-			ChatHistory: input.Messages,
+		handedOff := false
+		defer func() {
+			if !handedOff {
+				release()
+			}
+		}()
+		history, pending, err := a.loadHistory(ctx, input.Messages)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
 		}
 		if input.EnableStreaming {
-			streamResp, invokeErr := a.flow.Stream(ctx, req)
+			state, loadErr := a.store.Load(ctx)
+			if loadErr != nil {
+				gen.Send(&adk.AgentEvent{Err: fmt.Errorf("failed to load session: %w", loadErr)})
+				return
+			}
+			streamResp, invokeErr := a.flow.Stream(ctx, &Request[T]{State: state, ChatHistory: history, StateInit: a.stateInit})
 			if invokeErr != nil {
 				gen.Send(&adk.AgentEvent{Err: fmt.Errorf("flow stream invoke failed: %w", invokeErr)})
 				return
 			}
-			if saveErr := a.store.Save(ctx, streamResp.State); saveErr != nil {
-				gen.Send(&adk.AgentEvent{Err: saveErr})
-				return
+			if !a.transactional {
+				if streamResp.State, err = a.saveTurn(ctx, streamResp.State, streamResp.Report); err != nil {
+					streamResp.MessageStream.Close()
+					gen.Send(&adk.AgentEvent{Err: err})
+					return
+				}
+			}
+			for _, event := range a.formEventsFor(streamResp.State, streamResp.Report) {
+				gen.Send(event)
 			}
-			msgStream := schema.StreamReaderWithConvert[string, *schema.Message](streamResp.MessageStream, func(content string) (*schema.Message, error) {
+			handedOff = true
+			t := &turn[T]{state: streamResp.State, pending: pending, release: release}
+			msgStream := schema.StreamReaderWithConvert[string, *schema.Message](a.finishStream(ctx, t, streamResp.MessageStream), func(content string) (*schema.Message, error) {
 				return &schema.Message{
 					Role:    schema.Assistant,
 					Content: content,
@@ -93,17 +241,27 @@ func (a *Agent[T]) Run(ctx context.Context, input *adk.AgentInput, options ...ad
 			return
 		}
 
-		resp, invokeErr := a.flow.Invoke(ctx, req)
-		if invokeErr != nil {
-			gen.Send(&adk.AgentEvent{
-				Err: fmt.Errorf("flow invoke failed: %w", invokeErr),
-			})
+		state, err := a.store.Load(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: fmt.Errorf("failed to load session: %w", err)})
 			return
 		}
-		if saveErr := a.store.Save(ctx, resp.State); saveErr != nil {
-			gen.Send(&adk.AgentEvent{Err: saveErr})
+		resp, err := a.flow.Invoke(ctx, &Request[T]{State: state, ChatHistory: history, StateInit: a.stateInit})
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: fmt.Errorf("flow invoke failed: %w", err)})
 			return
 		}
+		if resp.State, err = a.saveTurn(ctx, resp.State, resp.Report); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+		if finishErr := a.finishTurn(ctx, &turn[T]{state: resp.State, pending: pending}, resp.Message); finishErr != nil {
+			gen.Send(&adk.AgentEvent{Err: finishErr})
+			return
+		}
+		for _, event := range a.formEventsFor(resp.State, resp.Report) {
+			gen.Send(event)
+		}
 		gen.Send(&adk.AgentEvent{
 			Output: &adk.AgentOutput{
 				MessageOutput: &adk.MessageVariant{
@@ -122,3 +280,212 @@ func (a *Agent[T]) Run(ctx context.Context, input *adk.AgentInput, options ...ad
 	}()
 	return iter
 }
+
+// saveTurn saves the state a turn produced. When another turn saved the session in the
+// meantime, the turn's patch is applied again to the newly stored state, up to
+// conflictRetries times, and the state that was saved is returned.
+func (a *Agent[T]) saveTurn(ctx context.Context, state *State[T], report *TurnReport) (*State[T], error) {
+	for attempt := 0; ; attempt++ {
+		err := a.store.Save(ctx, state)
+		if !errors.Is(err, ErrStateConflict) || attempt >= a.conflictRetries {
+			return state, err
+		}
+		fresh, loadErr := a.store.Load(ctx)
+		if loadErr != nil {
+			return state, fmt.Errorf("failed to load session: %w", loadErr)
+		}
+		rebased, ok := a.rebaseTurn(fresh, state, report)
+		if !ok {
+			return state, err
+		}
+		slog.Warn("State changed during turn, applying its patch again", "attempt", attempt+1, "error", err)
+		state = rebased
+	}
+}
+
+// rebaseTurn applies the patch of an edit turn to fresh. Turns that called the
+// Submitter, or whose intent changed the form in other ways, cannot be applied twice
+// and are not rebased.
+func (a *Agent[T]) rebaseTurn(fresh, state *State[T], report *TurnReport) (*State[T], bool) {
+	if report == nil || report.Submitted || fresh.Phase != report.PreviousPhase {
+		return nil, false
+	}
+	if report.Intent != indent.Edit && report.Intent != indent.DoNothing {
+		return nil, false
+	}
+	next := &State[T]{
+		Phase:        state.Phase,
+		FormState:    fresh.FormState,
+		PatchHistory: fresh.PatchHistory.Clone(),
+		Version:      fresh.Version,
+	}
+	if len(report.Ops) == 0 {
+		return next, true
+	}
+	formState, inverse, err := patch.ApplyRFC6902WithInverse(fresh.FormState, report.Ops)
+	if err != nil {
+		slog.Warn("Failed to apply patch to the newly stored state", "error", err)
+		return nil, false
+	}
+	next.FormState = formState
+	next.PatchHistory.Push(patch.Record{Ops: report.Ops, Inverse: inverse}, a.flow.PatchHistoryLimit)
+	return next, true
+}
+
+// lockTurn waits until no other turn of the same session is running when a session
+// locker is set. The returned function must be called once the turn is complete.
+func (a *Agent[T]) lockTurn(ctx context.Context) (func(), error) {
+	if a.locker == nil {
+		return func() {}, nil
+	}
+	key, ok := a.lockKey(ctx)
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	unlock, err := a.locker.Lock(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock session: %w", err)
+	}
+	return func() {
+		if err := unlock(); err != nil {
+			slog.Warn("Failed to unlock session", "key", key, "error", err)
+		}
+	}, nil
+}
+
+// loadHistory appends the incoming messages to the stored history. Without a history
+// store the input is the whole history. In transactional mode the incoming messages are
+// returned as pending instead of being written right away.
+func (a *Agent[T]) loadHistory(ctx context.Context, messages []*schema.Message) ([]*schema.Message, []*schema.Message, error) {
+	if a.history == nil {
+		return messages, nil, nil
+	}
+	if a.transactional {
+		history, err := a.history.Load(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load history: %w", err)
+		}
+		return appendHistory(slices.Clone(history), messages...), messages, nil
+	}
+	history, err := a.history.Append(ctx, messages...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to append history: %w", err)
+	}
+	return history, nil, nil
+}
+
+// finishStream forwards stream and completes the turn once the reader has received the
+// last chunk. A reply that is not read to the end, because the reader closed it or ctx
+// was cancelled, is not recorded.
+func (a *Agent[T]) finishStream(ctx context.Context, t *turn[T], stream *schema.StreamReader[string]) *schema.StreamReader[string] {
+	release := t.release
+	if release == nil {
+		release = func() {}
+	}
+	if !a.transactional && a.history == nil && a.locker == nil && !a.endsSession(t.state) {
+		return stream
+	}
+	sr, sw := schema.Pipe[string](0)
+	// closing sr unblocks Send; automatic close lets both the reader and ctx close it
+	sr.SetAutomaticClose()
+	stop := context.AfterFunc(ctx, sr.Close)
+	// the turn is still recorded or rolled back after ctx is cancelled
+	persistCtx := context.WithoutCancel(ctx)
+	go func() {
+		defer release()
+		defer stop()
+		defer stream.Close()
+		defer sw.Close()
+		var reply strings.Builder
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				a.abortTurn(persistCtx, t, err)
+				sw.Send("", err)
+				return
+			}
+			reply.WriteString(chunk)
+			if closed := sw.Send(chunk, nil); closed {
+				cause := ctx.Err()
+				if cause == nil {
+					cause = errors.New("reply stream closed by reader")
+				}
+				a.abortTurn(persistCtx, t, cause)
+				return
+			}
+		}
+		if a.transactional {
+			if err := a.store.Save(persistCtx, t.state); err != nil {
+				sw.Send("", err)
+				return
+			}
+		}
+		if err := a.finishTurn(persistCtx, t, reply.String()); err != nil {
+			sw.Send("", err)
+		}
+	}()
+	return sr
+}
+
+// abortTurn handles a reply stream that did not complete. Outside transactional mode
+// the state is already saved and only the reply is lost.
+func (a *Agent[T]) abortTurn(ctx context.Context, t *turn[T], cause error) {
+	if !a.transactional {
+		slog.Debug("Reply stream did not complete, history not updated", "error", cause)
+		return
+	}
+	if a.rollbackOnError {
+		slog.Warn("Reply stream did not complete, rolling back turn", "error", cause)
+		return
+	}
+	slog.Warn("Reply stream did not complete, saving state without reply", "error", cause)
+	if err := a.store.Save(ctx, t.state); err != nil {
+		slog.Warn("Failed to save state", "error", err)
+	}
+	if a.history != nil && len(t.pending) > 0 {
+		if _, err := a.history.Append(ctx, t.pending...); err != nil {
+			slog.Warn("Failed to append history", "error", err)
+		}
+	}
+}
+
+// finishTurn records the pending messages and the assistant reply, then applies the
+// session end policy.
+func (a *Agent[T]) finishTurn(ctx context.Context, t *turn[T], reply string) error {
+	state := t.state
+	var history []*schema.Message
+	if a.history != nil {
+		var err error
+		messages := append(slices.Clone(t.pending), schema.AssistantMessage(reply, nil))
+		history, err = a.history.Append(ctx, messages...)
+		if err != nil {
+			return fmt.Errorf("failed to append history: %w", err)
+		}
+	}
+	if !a.endsSession(state) {
+		return nil
+	}
+	if a.endPolicy == SessionEndArchive {
+		if a.archiver == nil {
+			slog.Warn("Session end policy is archive but no archiver is set, clearing session")
+		} else if err := a.archiver.Archive(ctx, state, history); err != nil {
+			return fmt.Errorf("failed to archive session: %w", err)
+		}
+	}
+	if err := a.store.Clear(ctx); err != nil {
+		return fmt.Errorf("failed to clear session: %w", err)
+	}
+	if a.history != nil {
+		if err := a.history.Clear(ctx); err != nil {
+			return fmt.Errorf("failed to clear history: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *Agent[T]) endsSession(state *State[T]) bool {
+	return a.endPolicy != SessionEndKeep && a.endPolicy != "" && IsTerminalPhase(state.Phase)
+}
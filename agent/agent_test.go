@@ -0,0 +1,538 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/types"
+)
+
+type testSessionKey struct{}
+
+func testSession(id string) (context.Context, agent.KeyGen) {
+	ctx := context.WithValue(context.Background(), testSessionKey{}, id)
+	return ctx, func(ctx context.Context) (string, bool) {
+		v, ok := ctx.Value(testSessionKey{}).(string)
+		return v, ok
+	}
+}
+
+// runAgent sends one user message and returns the concatenated reply.
+func runAgent(t *testing.T, ctx context.Context, a adk.Agent, message string, streaming bool) string {
+	t.Helper()
+	iter := a.Run(ctx, &adk.AgentInput{
+		Messages:        []adk.Message{schema.UserMessage(message)},
+		EnableStreaming: streaming,
+	})
+	var content strings.Builder
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			return content.String()
+		}
+		if event.Err != nil {
+			t.Fatalf("agent error: %v", event.Err)
+		}
+		out := event.Output.MessageOutput
+		if !out.IsStreaming {
+			content.WriteString(out.Message.Content)
+			continue
+		}
+		for {
+			msg, err := out.MessageStream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("stream error: %v", err)
+			}
+			content.WriteString(msg.Content)
+		}
+	}
+}
+
+func TestAgent_HistoryAndArchive(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		m := formagenttest.NewFakeChatModel()
+		m.OnTool("parse_intent").WhenUserSays("取消").ReplyToolCall(`{"intent":"cancel"}`)
+		m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+		m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+		m.OnText().ReplyStream("金额", "是多少？")
+		flow := newTestFlow(t, m)
+
+		ctx, keygen := testSession("s1")
+		store := agent.NewStateStore[*expense](
+			agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+			func(ctx context.Context) *expense { return &expense{} },
+		)
+		history := agent.NewHistoryStore(agent.NewStore[[]*schema.Message](agent.NewMemoryCore[[]*schema.Message](), "history", keygen))
+		var archived []*schema.Message
+		var archivedPhase types.Phase
+		a := agent.NewAgent("test", "test agent", flow, store,
+			agent.WithHistory[*expense](history),
+			agent.WithArchiver[*expense](agent.ArchiverFunc[*expense](func(ctx context.Context, state *agent.State[*expense], h []*schema.Message) error {
+				archived, archivedPhase = h, state.Phase
+				return nil
+			})),
+		)
+
+		if reply := runAgent(t, ctx, a, "打车", streaming); reply != "金额是多少？" {
+			t.Fatalf("streaming=%v: reply = %q", streaming, reply)
+		}
+		saved, _ := history.Load(ctx)
+		if len(saved) != 2 || saved[0].Content != "打车" || saved[1].Content != "金额是多少？" {
+			t.Fatalf("streaming=%v: history not persisted: %v", streaming, saved)
+		}
+
+		runAgent(t, ctx, a, "second", streaming)
+		if calls := m.CallsFor("parse_intent"); !strings.Contains(calls[len(calls)-1].Prompt(), "打车") {
+			t.Fatalf("streaming=%v: stored history not passed to the flow", streaming)
+		}
+
+		runAgent(t, ctx, a, "取消", streaming)
+		if archivedPhase != types.PhaseCancelled || len(archived) != 6 {
+			t.Fatalf("streaming=%v: session not archived: %s, %d messages", streaming, archivedPhase, len(archived))
+		}
+		if saved, _ := history.Load(ctx); len(saved) != 0 {
+			t.Fatalf("streaming=%v: history not cleared", streaming)
+		}
+		if state, _ := store.Load(ctx); state.Phase != types.PhaseCollecting || state.FormState.Title != "" {
+			t.Fatalf("streaming=%v: state not cleared: %+v", streaming, state)
+		}
+	}
+}
+
+func newTransactionalAgent(t *testing.T, reply formagenttest.Reply, rollback bool, opts ...agent.AgentOption[*expense]) (context.Context, *agent.Agent[*expense], *agent.StateStore[*expense], *agent.HistoryStore) {
+	t.Helper()
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+	m.OnText().Reply(reply)
+	flow := newTestFlow(t, m)
+
+	ctx, keygen := testSession("s1")
+	store := agent.NewStateStore[*expense](
+		agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+		func(ctx context.Context) *expense { return &expense{} },
+	)
+	history := agent.NewHistoryStore(agent.NewStore[[]*schema.Message](agent.NewMemoryCore[[]*schema.Message](), "history", keygen))
+	opts = append(opts, agent.WithHistory[*expense](history), agent.WithTransactionalStream[*expense](rollback))
+	a := agent.NewAgent("test", "test agent", flow, store, opts...)
+	return ctx, a, store, history
+}
+
+// openStream runs one streamed turn and returns the reply stream without reading it.
+func openStream(t *testing.T, ctx context.Context, a adk.Agent) *schema.StreamReader[*schema.Message] {
+	t.Helper()
+	iter := a.Run(ctx, &adk.AgentInput{Messages: []adk.Message{schema.UserMessage("打车")}, EnableStreaming: true})
+	event, ok := iter.Next()
+	if !ok || event.Err != nil {
+		t.Fatalf("expected a stream event, got %v", event)
+	}
+	return event.Output.MessageOutput.MessageStream
+}
+
+func TestAgent_TransactionalStream(t *testing.T) {
+	t.Run("commit after stream is consumed", func(t *testing.T) {
+		ctx, a, store, history := newTransactionalAgent(t, formagenttest.Reply{Content: "金额是多少？", Chunks: []string{"金额", "是多少？"}}, true)
+		stream := openStream(t, ctx, a)
+		if state, _ := store.Load(ctx); state.FormState.Title != "" {
+			t.Fatal("state saved before the reply was read")
+		}
+		for {
+			if _, err := stream.Recv(); err != nil {
+				break
+			}
+		}
+		if state, _ := store.Load(ctx); state.FormState.Title != "打车" {
+			t.Fatal("state not saved after the reply was read")
+		}
+		if saved, _ := history.Load(ctx); len(saved) != 2 {
+			t.Fatalf("history = %d messages, want 2", len(saved))
+		}
+	})
+
+	t.Run("rollback on stream error", func(t *testing.T) {
+		ctx, a, store, history := newTransactionalAgent(t, formagenttest.Reply{Content: "金额", Err: errors.New("connection reset")}, true)
+		stream := openStream(t, ctx, a)
+		var err error
+		for err == nil {
+			_, err = stream.Recv()
+		}
+		if errors.Is(err, io.EOF) {
+			t.Fatal("stream error was swallowed")
+		}
+		if state, _ := store.Load(ctx); state.FormState.Title != "" {
+			t.Fatal("state should be rolled back")
+		}
+		if saved, _ := history.Load(ctx); len(saved) != 0 {
+			t.Fatalf("history should be rolled back, got %d messages", len(saved))
+		}
+	})
+
+	t.Run("reader disconnects without rollback", func(t *testing.T) {
+		ctx, a, store, history := newTransactionalAgent(t, formagenttest.Reply{Content: "金额是多少？", Chunks: []string{"金额", "是", "多少？"}}, false)
+		stream := openStream(t, ctx, a)
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		stream.Close()
+		deadline := time.Now().Add(time.Second)
+		// the history is written last
+		for {
+			if saved, _ := history.Load(ctx); len(saved) > 0 {
+				if len(saved) != 1 || saved[0].Role != schema.User {
+					t.Fatalf("only the user message should be recorded, got %d messages", len(saved))
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("turn not saved after the reader went away")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if state, _ := store.Load(ctx); state.FormState.Title != "打车" {
+			t.Fatal("state not saved after the reader went away")
+		}
+	})
+}
+
+func TestAgent_TransactionalStreamCancelled(t *testing.T) {
+	parent, a, store, history := newTransactionalAgent(t, formagenttest.Reply{Content: "金额是多少？", Chunks: []string{"金额", "是", "多少？"}}, false)
+	ctx, cancel := context.WithCancel(parent)
+	stream := openStream(t, ctx, a)
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// the client goes away without reading or closing the stream
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if saved, _ := history.Load(parent); len(saved) > 0 {
+			if len(saved) != 1 || saved[0].Role != schema.User {
+				t.Fatalf("only the user message should be recorded, got %d messages", len(saved))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("turn not finished after ctx was cancelled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if state, _ := store.Load(parent); state.FormState.Title != "打车" {
+		t.Fatal("state not saved after ctx was cancelled")
+	}
+}
+
+func TestAgent_FormEvents(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").WhenUserSays("确认").ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").
+		ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"},{"op":"add","path":"/amount","value":42}]}`)
+	m.OnText().ReplyText("好的")
+	flow := newTestFlow(t, m)
+
+	ctx, keygen := testSession("s1")
+	store := agent.NewStateStore[*expense](
+		agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+		func(ctx context.Context) *expense { return &expense{} },
+	)
+	a := agent.NewAgent("test", "test agent", flow, store, agent.WithFormEvents[*expense]())
+
+	collect := func(message string, streaming bool) []any {
+		iter := a.Run(ctx, &adk.AgentInput{
+			Messages:        []adk.Message{schema.UserMessage(message)},
+			EnableStreaming: streaming,
+		})
+		var actions []any
+		for {
+			event, ok := iter.Next()
+			if !ok {
+				return actions
+			}
+			if event.Err != nil {
+				t.Fatalf("agent error: %v", event.Err)
+			}
+			if event.Action != nil {
+				actions = append(actions, event.Action.CustomizedAction)
+			} else if event.Output.MessageOutput.IsStreaming {
+				event.Output.MessageOutput.MessageStream.Close()
+			}
+		}
+	}
+
+	actions := collect("打车 42", false)
+	if len(actions) != 3 {
+		t.Fatalf("edit turn: got %d events, want 3: %#v", len(actions), actions)
+	}
+	if e, ok := actions[0].(*agent.IntentEvent); !ok || e.Intent != "edit" {
+		t.Fatalf("first event = %#v, want edit intent", actions[0])
+	}
+	if e, ok := actions[1].(*agent.PatchEvent); !ok || len(e.Ops) != 2 || e.Ops[1].Path != "/amount" {
+		t.Fatalf("second event = %#v, want applied ops", actions[1])
+	}
+	if e, ok := actions[2].(*agent.FormUpdatedEvent[*expense]); !ok || e.FormState.Amount != 42 || len(e.MissingFields) != 0 {
+		t.Fatalf("third event = %#v, want updated form", actions[2])
+	}
+
+	actions = collect("确认", true)
+	if len(actions) != 3 {
+		t.Fatalf("confirm turn: got %d events, want 3: %#v", len(actions), actions)
+	}
+	if _, ok := actions[1].(*agent.FormUpdatedEvent[*expense]); !ok {
+		t.Fatalf("second event = %#v, want form update", actions[1])
+	}
+	if e, ok := actions[2].(*agent.PhaseChangedEvent); !ok || e.From != types.PhaseCollecting || e.To != types.PhaseConfirming {
+		t.Fatalf("third event = %#v, want collecting -> confirming", actions[2])
+	}
+}
+
+func TestStateStore_VersionConflict(t *testing.T) {
+	ctx, keygen := testSession("s1")
+	store := agent.NewStateStore[*expense](
+		agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+		func(ctx context.Context) *expense { return &expense{} },
+	)
+	first, _ := store.Load(ctx)
+	second, _ := store.Load(ctx)
+	if err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{Title: "a"}, Version: first.Version}); err != nil {
+		t.Fatalf("first save failed: %v", err)
+	}
+	err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{Title: "b"}, Version: second.Version})
+	var conflict *agent.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, agent.ErrStateConflict) || conflict.Expected != 0 || conflict.Actual != 1 {
+		t.Fatalf("second save error = %v, want conflict", err)
+	}
+	if state, _ := store.Load(ctx); state.FormState.Title != "a" || state.Version != 1 {
+		t.Fatalf("stored state = %+v, want first save", state)
+	}
+}
+
+func TestStateStore_LoadsConfirmedAsSubmitted(t *testing.T) {
+	ctx, keygen := testSession("s1")
+	cache := agent.NewMemoryCore[*agent.State[*expense]]()
+	store := agent.NewStateStore[*expense](agent.NewStore[*agent.State[*expense]](cache, "state", keygen), nil)
+	if err := cache.Set(ctx, "state:s1", &agent.State[*expense]{Phase: types.PhaseConfirmed, FormState: &expense{Title: "打车"}, Version: 3}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Phase != types.PhaseSubmitted || state.FormState.Title != "打车" || state.Version != 3 {
+		t.Fatalf("loaded state = %+v", state)
+	}
+	if !agent.IsTerminalPhase(types.PhaseConfirmed) {
+		t.Fatal("confirmed phase is not terminal")
+	}
+	if err := store.Save(ctx, state); err != nil {
+		t.Fatalf("save of migrated state failed: %v", err)
+	}
+}
+
+func TestAgent_ConflictRetry(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		ctx, keygen := testSession("s1")
+		store := agent.NewStateStore[*expense](
+			agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+			func(ctx context.Context) *expense { return &expense{} },
+		)
+		interfered := false
+		m := formagenttest.NewFakeChatModel()
+		// another turn saves the session while this one waits for the model
+		m.OnAny().When(func(call *formagenttest.Call) bool {
+			if !interfered {
+				interfered = true
+				if err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{Amount: 99}}); err != nil {
+					t.Fatalf("concurrent save failed: %v", err)
+				}
+			}
+			return false
+		}).ReplyText("")
+		m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+		m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+		m.OnText().ReplyText("好的")
+		a := agent.NewAgent("test", "test agent", newTestFlow(t, m), store, agent.WithConflictRetry[*expense](retries))
+
+		iter := a.Run(ctx, &adk.AgentInput{Messages: []adk.Message{schema.UserMessage("打车")}})
+		event, _ := iter.Next()
+		state, _ := store.Load(ctx)
+		if retries == 0 {
+			if !errors.Is(event.Err, agent.ErrStateConflict) {
+				t.Fatalf("retries=0: error = %v, want conflict", event.Err)
+			}
+			if state.FormState.Title != "" || state.Version != 1 {
+				t.Fatalf("retries=0: concurrent save overwritten: %+v", state)
+			}
+			continue
+		}
+		if event.Err != nil {
+			t.Fatalf("retries=1: agent error: %v", event.Err)
+		}
+		if state.FormState.Title != "打车" || state.FormState.Amount != 99 || state.Version != 2 {
+			t.Fatalf("retries=1: patch not applied to fresh state: %+v", state.FormState)
+		}
+		if len(state.PatchHistory.Undo) != 1 || len(m.CallsFor("update_form")) != 1 {
+			t.Fatalf("retries=1: turn rerun instead of rebased: %+v", state.PatchHistory)
+		}
+	}
+}
+
+func TestAgent_ConflictAfterSubmitIsNotRetried(t *testing.T) {
+	ctx, keygen := testSession("s1")
+	store := agent.NewStateStore[*expense](
+		agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+		func(ctx context.Context) *expense { return &expense{} },
+	)
+	if err := store.Save(ctx, &agent.State[*expense]{Phase: types.PhaseConfirming, FormState: &expense{Title: "打车", Amount: 42}}); err != nil {
+		t.Fatal(err)
+	}
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnText().ReplyText("好的")
+	flow := newTestFlow(t, m)
+	submits := 0
+	flow.Submitter = agent.SubmitterFunc[*expense](func(ctx context.Context, current *expense) (*agent.Receipt, error) {
+		submits++
+		// another turn saves the session while the form is being submitted
+		state, _ := store.Load(ctx)
+		if err := store.Save(ctx, &agent.State[*expense]{Phase: state.Phase, FormState: current, Version: state.Version}); err != nil {
+			t.Fatalf("concurrent save failed: %v", err)
+		}
+		return &agent.Receipt{ID: "INV-1"}, nil
+	})
+	a := agent.NewAgent("test", "test agent", flow, store, agent.WithConflictRetry[*expense](3))
+
+	iter := a.Run(ctx, &adk.AgentInput{Messages: []adk.Message{schema.UserMessage("确认")}})
+	event, _ := iter.Next()
+	if !errors.Is(event.Err, agent.ErrStateConflict) {
+		t.Fatalf("error = %v, want conflict", event.Err)
+	}
+	if submits != 1 {
+		t.Fatalf("form submitted %d times, want once", submits)
+	}
+}
+
+func TestAgent_SerializedTurns(t *testing.T) {
+	lockers := map[string]agent.SessionLocker{
+		"memory": agent.NewMemorySessionLocker(0),
+		"cache":  &cacheLocker{cache: agent.NewMemoryCore[string](), token: "node-1"},
+	}
+	for name, locker := range lockers {
+		m := formagenttest.NewFakeChatModel()
+		m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+		m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+		m.OnText().ReplyText("好的")
+		ctx, keygen := testSession("s1")
+		store := agent.NewStateStore[*expense](
+			agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+			func(ctx context.Context) *expense { return &expense{} },
+		)
+		a := agent.NewAgent("test", "test agent", newTestFlow(t, m), store, agent.WithSessionLocker[*expense](locker, keygen))
+
+		done := make(chan struct{})
+		for range 4 {
+			go func() {
+				defer func() { done <- struct{}{} }()
+				runAgent(t, ctx, a, "打车", true)
+			}()
+		}
+		for range 4 {
+			<-done
+		}
+		if state, _ := store.Load(ctx); state.Version != 4 {
+			t.Fatalf("%s: version = %d, want 4 serialized saves", name, state.Version)
+		}
+	}
+}
+
+func TestAgent_StreamHoldsSessionLock(t *testing.T) {
+	reply := formagenttest.Reply{Content: "金额是多少？", Chunks: []string{"金额", "是", "多少？"}}
+	for _, transactional := range []bool{false, true} {
+		locker := agent.NewMemorySessionLocker(0)
+		_, keygen := testSession("s1")
+		var parent context.Context
+		var a *agent.Agent[*expense]
+		var store *agent.StateStore[*expense]
+		if transactional {
+			parent, a, store, _ = newTransactionalAgent(t, reply, true, agent.WithSessionLocker[*expense](locker, keygen))
+		} else {
+			m := formagenttest.NewFakeChatModel()
+			m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+			m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+			m.OnText().Reply(reply)
+			parent, _ = testSession("s1")
+			store = agent.NewStateStore[*expense](
+				agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+				func(ctx context.Context) *expense { return &expense{} },
+			)
+			a = agent.NewAgent("test", "test agent", newTestFlow(t, m), store, agent.WithSessionLocker[*expense](locker, keygen))
+		}
+		locked := func(wait time.Duration) bool {
+			ctx, cancel := context.WithTimeout(parent, wait)
+			defer cancel()
+			unlock, err := locker.Lock(ctx, "s1")
+			if err != nil {
+				return true
+			}
+			_ = unlock()
+			return false
+		}
+
+		ctx, cancel := context.WithCancel(parent)
+		openStream(t, ctx, a)
+		if !locked(20 * time.Millisecond) {
+			t.Fatalf("transactional=%v: lock released before the reply was read", transactional)
+		}
+		// the client goes away without reading or closing the stream
+		cancel()
+		if locked(time.Second) {
+			t.Fatalf("transactional=%v: lock not released after ctx was cancelled", transactional)
+		}
+		state, _ := store.Load(parent)
+		if transactional && state.Version != 0 {
+			t.Fatal("transactional=true: turn not rolled back")
+		}
+		if !transactional && state.Version != 1 {
+			t.Fatal("transactional=false: state not saved")
+		}
+	}
+}
+
+func TestAgent_SharedFlowKeepsStoreInitializers(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"reset"}`)
+	m.OnText().ReplyText("表单已清空")
+	flow := newTestFlow(t, m)
+	ctx, keygen := testSession("s1")
+	newStore := func(title string) *agent.StateStore[*expense] {
+		return agent.NewStateStore[*expense](
+			agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "state", keygen),
+			func(ctx context.Context) *expense { return &expense{Title: title} },
+		)
+	}
+	taxi, lunch := newStore("打车"), newStore("午餐")
+	agents := map[string]*agent.Agent[*expense]{
+		"打车": agent.NewAgent("taxi", "taxi agent", flow, taxi),
+		"午餐": agent.NewAgent("lunch", "lunch agent", flow, lunch),
+	}
+	stores := map[string]*agent.StateStore[*expense]{"打车": taxi, "午餐": lunch}
+	if flow.StateInit != nil {
+		t.Fatal("NewAgent modified the shared flow")
+	}
+	for title, a := range agents {
+		runAgent(t, ctx, a, "重新开始", false)
+		if state, _ := stores[title].Load(ctx); state.FormState.Title != title || state.Version != 1 {
+			t.Fatalf("reset with %s store gave %+v", title, state.FormState)
+		}
+	}
+}
@@ -3,36 +3,122 @@ package agent
 import (
 	"context"
 	"sync"
+	"time"
+
+	"github.com/tbxark/formagent/types"
 )
 
+// Cache stores values by key. Set and CompareAndSet write with the cache's default TTL,
+// if it has one; a value written by CompareAndSet does not keep the TTL of the value it
+// replaces.
 type Cache[S any] interface {
 	Set(ctx context.Context, key string, val S) error
+	// SetWithTTL stores val until it has not been written, or read when the cache slides
+	// expiration, for ttl. A ttl of zero or less never expires.
+	SetWithTTL(ctx context.Context, key string, val S, ttl time.Duration) error
 	Get(ctx context.Context, key string) (S, bool, error)
 	Del(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
+	// CompareAndSet stores val only if match accepts the current value, checked and
+	// written atomically. ok is false when no value is stored under key.
+	CompareAndSet(ctx context.Context, key string, val S, match func(current S, ok bool) bool) (bool, error)
+}
+
+type memoryEntry[S any] struct {
+	val     S
+	ttl     time.Duration
+	expires time.Time
+}
+
+func (e *memoryEntry[S]) expired(now time.Time) bool {
+	return e.ttl > 0 && !now.Before(e.expires)
 }
 
 type MemoryCache[S any] struct {
 	mu sync.RWMutex
-	m  map[string]S
+	m  map[string]*memoryEntry[S]
+
+	defaultTTL time.Duration
+	sliding    bool
+	clock      types.Clock
+	onExpire   func(key string, val S)
+	interval   time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+type MemoryCacheOption[S any] func(*MemoryCache[S])
+
+// WithDefaultTTL sets the TTL used by Set and CompareAndSet.
+func WithDefaultTTL[S any](ttl time.Duration) MemoryCacheOption[S] {
+	return func(m *MemoryCache[S]) {
+		m.defaultTTL = ttl
+	}
+}
+
+// WithSlidingExpiration makes Get and Exists restart the TTL of the entry they find.
+func WithSlidingExpiration[S any]() MemoryCacheOption[S] {
+	return func(m *MemoryCache[S]) {
+		m.sliding = true
+	}
+}
+
+// WithJanitor removes expired entries every interval until Close is called. Without a
+// janitor expired entries are only dropped when they are accessed.
+func WithJanitor[S any](interval time.Duration) MemoryCacheOption[S] {
+	return func(m *MemoryCache[S]) {
+		m.interval = interval
+	}
+}
+
+// WithOnExpire calls fn with every entry that is dropped because it expired. It is not
+// called for entries removed with Del.
+func WithOnExpire[S any](fn func(key string, val S)) MemoryCacheOption[S] {
+	return func(m *MemoryCache[S]) {
+		m.onExpire = fn
+	}
 }
 
-func NewMemoryCore[S any]() *MemoryCache[S] {
-	return &MemoryCache[S]{m: map[string]S{}}
+// WithCacheClock sets the clock used for expiration, for tests.
+func WithCacheClock[S any](clock types.Clock) MemoryCacheOption[S] {
+	return func(m *MemoryCache[S]) {
+		m.clock = clock
+	}
+}
+
+func NewMemoryCore[S any](opts ...MemoryCacheOption[S]) *MemoryCache[S] {
+	m := &MemoryCache[S]{
+		m:     map[string]*memoryEntry[S]{},
+		clock: time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.interval > 0 {
+		m.stop = make(chan struct{})
+		go m.janitor(m.interval)
+	}
+	return m
 }
 
 func (m *MemoryCache[S]) Set(ctx context.Context, key string, val S) error {
+	return m.SetWithTTL(ctx, key, val, m.defaultTTL)
+}
+
+func (m *MemoryCache[S]) SetWithTTL(ctx context.Context, key string, val S, ttl time.Duration) error {
 	m.mu.Lock()
-	m.m[key] = val
+	m.m[key] = m.newEntry(val, ttl)
 	m.mu.Unlock()
 	return nil
 }
 
 func (m *MemoryCache[S]) Get(ctx context.Context, key string) (S, bool, error) {
-	m.mu.RLock()
-	val, ok := m.m[key]
-	m.mu.RUnlock()
-	return val, ok, nil
+	entry, ok := m.lookup(key)
+	if !ok {
+		var zero S
+		return zero, false, nil
+	}
+	return entry.val, true, nil
 }
 
 func (m *MemoryCache[S]) Del(ctx context.Context, key string) error {
@@ -43,8 +129,111 @@ func (m *MemoryCache[S]) Del(ctx context.Context, key string) error {
 }
 
 func (m *MemoryCache[S]) Exists(ctx context.Context, key string) (bool, error) {
-	m.mu.RLock()
-	_, ok := m.m[key]
-	m.mu.RUnlock()
+	_, ok := m.lookup(key)
 	return ok, nil
 }
+
+func (m *MemoryCache[S]) CompareAndSet(ctx context.Context, key string, val S, match func(current S, ok bool) bool) (bool, error) {
+	m.mu.Lock()
+	entry, expired := m.m[key], false
+	if entry != nil && entry.expired(m.clock()) {
+		delete(m.m, key)
+		expired = true
+	}
+	var current S
+	if entry != nil && !expired {
+		current = entry.val
+	}
+	saved := match(current, entry != nil && !expired)
+	if saved {
+		m.m[key] = m.newEntry(val, m.defaultTTL)
+	}
+	m.mu.Unlock()
+	if expired {
+		m.expire(key, entry.val)
+	}
+	return saved, nil
+}
+
+// DeleteExpired removes all expired entries. It is called by the janitor.
+func (m *MemoryCache[S]) DeleteExpired() {
+	now := m.clock()
+	expired := make(map[string]S)
+	m.mu.Lock()
+	for key, entry := range m.m {
+		if entry.expired(now) {
+			expired[key] = entry.val
+			delete(m.m, key)
+		}
+	}
+	m.mu.Unlock()
+	for key, val := range expired {
+		m.expire(key, val)
+	}
+}
+
+// Close stops the janitor.
+func (m *MemoryCache[S]) Close() error {
+	if m.stop != nil {
+		m.stopOnce.Do(func() { close(m.stop) })
+	}
+	return nil
+}
+
+func (m *MemoryCache[S]) newEntry(val S, ttl time.Duration) *memoryEntry[S] {
+	entry := &memoryEntry[S]{val: val, ttl: ttl}
+	if ttl > 0 {
+		entry.expires = m.clock().Add(ttl)
+	}
+	return entry
+}
+
+// lookup returns a live entry, dropping it if it has expired and sliding its expiration
+// otherwise.
+func (m *MemoryCache[S]) lookup(key string) (*memoryEntry[S], bool) {
+	if !m.sliding {
+		m.mu.RLock()
+		entry, ok := m.m[key]
+		m.mu.RUnlock()
+		if !ok || !entry.expired(m.clock()) {
+			return entry, ok
+		}
+	}
+	now := m.clock()
+	m.mu.Lock()
+	entry, ok := m.m[key]
+	if !ok {
+		m.mu.Unlock()
+		return nil, false
+	}
+	if entry.expired(now) {
+		delete(m.m, key)
+		m.mu.Unlock()
+		m.expire(key, entry.val)
+		return nil, false
+	}
+	if m.sliding && entry.ttl > 0 {
+		entry.expires = now.Add(entry.ttl)
+	}
+	m.mu.Unlock()
+	return entry, true
+}
+
+func (m *MemoryCache[S]) expire(key string, val S) {
+	if m.onExpire != nil {
+		m.onExpire(key, val)
+	}
+}
+
+func (m *MemoryCache[S]) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.DeleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package agent_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/agent/sqlitecache"
+)
+
+func TestMemoryCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	var expired []string
+	cache := agent.NewMemoryCore[string](
+		agent.WithDefaultTTL[string](time.Minute),
+		agent.WithSlidingExpiration[string](),
+		agent.WithCacheClock[string](func() time.Time { return now }),
+		agent.WithOnExpire[string](func(key, val string) { expired = append(expired, key+"="+val) }),
+	)
+	_ = cache.Set(ctx, "active", "a")
+	_ = cache.Set(ctx, "abandoned", "b")
+	_ = cache.SetWithTTL(ctx, "forever", "c", 0)
+	_ = cache.Set(ctx, "deleted", "d")
+	_ = cache.Del(ctx, "deleted")
+
+	for range 3 {
+		now = now.Add(40 * time.Second)
+		if _, ok, _ := cache.Get(ctx, "active"); !ok {
+			t.Fatal("read entry expired despite sliding expiration")
+		}
+	}
+	if ok, _ := cache.Exists(ctx, "abandoned"); ok {
+		t.Fatal("abandoned entry did not expire")
+	}
+	now = now.Add(time.Hour)
+	cache.DeleteExpired()
+	if _, ok, _ := cache.Get(ctx, "forever"); !ok {
+		t.Fatal("entry without TTL expired")
+	}
+	slices.Sort(expired)
+	if !slices.Equal(expired, []string{"abandoned=b", "active=a"}) {
+		t.Fatalf("OnExpire calls = %v", expired)
+	}
+}
+
+func TestMemoryCache_Janitor(t *testing.T) {
+	done := make(chan string, 1)
+	cache := agent.NewMemoryCore[string](
+		agent.WithJanitor[string](time.Millisecond),
+		agent.WithOnExpire[string](func(key, val string) { done <- key }),
+	)
+	defer cache.Close()
+	_ = cache.SetWithTTL(context.Background(), "s1", "form", time.Millisecond)
+	select {
+	case key := <-done:
+		if key != "s1" {
+			t.Fatalf("expired key = %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not remove the expired entry")
+	}
+}
+
+// TestCache_CompareAndSetUsesDefaultTTL checks that state saved through CompareAndSet
+// expires with the default TTL on every backend.
+func TestCache_CompareAndSetUsesDefaultTTL(t *testing.T) {
+	ctx, keygen := testSession("s1")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	type state = *agent.State[*expense]
+
+	files, err := agent.NewFileCache[state](t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.DefaultTTL, files.Clock = time.Minute, clock
+	rows, err := sqlitecache.Open[state](ctx, filepath.Join(t.TempDir(), "cache.db"), "states", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	rows.DefaultTTL, rows.Clock = time.Minute, clock
+	caches := map[string]agent.Cache[state]{
+		"memory": agent.NewMemoryCore[state](agent.WithDefaultTTL[state](time.Minute), agent.WithCacheClock[state](clock)),
+		"file":   files,
+		"sqlite": rows,
+	}
+	for name, cache := range caches {
+		now = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+		store := agent.NewStateStore[*expense](agent.NewStore[state](cache, "state", keygen), nil)
+		if err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{Title: "打车"}}); err != nil {
+			t.Fatalf("%s: Save failed: %v", name, err)
+		}
+		now = now.Add(30 * time.Second)
+		if loaded, _ := store.Load(ctx); loaded.Version != 1 {
+			t.Fatalf("%s: state expired early", name)
+		}
+		now = now.Add(time.Minute)
+		if loaded, _ := store.Load(ctx); loaded.Version != 0 {
+			t.Fatalf("%s: state saved with CompareAndSet did not expire", name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tbxark/formagent/types"
+)
+
+// Codec converts cache values to bytes for the persistent caches.
+type Codec[S any] interface {
+	Marshal(val S) ([]byte, error)
+	Unmarshal(data []byte) (S, error)
+}
+
+// JSONCodec encodes values with encoding/json. It is the default codec.
+type JSONCodec[S any] struct{}
+
+func (JSONCodec[S]) Marshal(val S) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JSONCodec[S]) Unmarshal(data []byte) (S, error) {
+	var val S
+	err := json.Unmarshal(data, &val)
+	return val, err
+}
+
+// expiresAt returns the expiry of an entry written now with ttl in Unix nanoseconds,
+// or zero when it does not expire.
+func expiresAt(clock types.Clock, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return clock().Add(ttl).UnixNano()
+}
+
+func isExpired(clock types.Clock, expiresAt int64) bool {
+	return expiresAt != 0 && clock().UnixNano() >= expiresAt
+}
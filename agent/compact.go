@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/types"
+)
+
+// DefaultCompactSystemPrompt is the system prompt HistoryCompactor sends to the model.
+const DefaultCompactSystemPrompt = `
+You maintain a running summary of a conversation between a user and a form-filling assistant.
+Merge the previous summary (if any) and the older messages into one short summary that the assistant can rely on instead of those messages.
+
+Rules:
+- Keep only what is still relevant: user preferences, open questions, corrections, decisions and anything the user asked to be remembered.
+- Do NOT repeat values that are already recorded in the current form state; it is shown separately.
+- Do not invent information. Do not address the user.
+- Write plain prose in the same language as the conversation, at most a few sentences.`
+
+// HistoryCompactor replaces older turns with a model-written summary once the history
+// grows beyond Threshold messages. The most recent KeepRecent messages, starting at a
+// user message, are kept verbatim.
+type HistoryCompactor struct {
+	ChatModel    model.BaseChatModel
+	SystemPrompt string
+	Threshold    int
+	KeepRecent   int
+	// FormState returns the current form summary so facts already captured in the form
+	// are left out of the summary. Optional.
+	FormState func(ctx context.Context) (string, error)
+}
+
+func NewHistoryCompactor(chatModel model.BaseChatModel) *HistoryCompactor {
+	return &HistoryCompactor{
+		ChatModel:    chatModel,
+		SystemPrompt: DefaultCompactSystemPrompt,
+		Threshold:    20,
+		KeepRecent:   6,
+	}
+}
+
+// FormStateSummary adapts a state store and form spec for HistoryCompactor.FormState.
+func FormStateSummary[T any](store StateReadWriter[T], spec FormSpec[T]) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		state, err := store.Load(ctx)
+		if err != nil {
+			return "", err
+		}
+		return spec.Summary(ctx, state.FormState), nil
+	}
+}
+
+// Compact returns the compacted history and whether it changed. Earlier summaries are
+// folded into the new one, so the result holds at most one summary message.
+func (c *HistoryCompactor) Compact(ctx context.Context, history []*schema.Message) ([]*schema.Message, bool, error) {
+	summaries, messages := types.SplitHistorySummary(history)
+	if len(messages) <= c.Threshold {
+		return history, false, nil
+	}
+	cut := len(messages) - max(c.KeepRecent, 1)
+	for cut > 0 && messages[cut].Role != schema.User {
+		cut--
+	}
+	if cut <= 0 {
+		return history, false, nil
+	}
+
+	prompt, err := c.buildPrompt(ctx, summaries, messages[:cut])
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := c.ChatModel.Generate(ctx, prompt)
+	if err != nil {
+		return nil, false, fmt.Errorf("summarize history failed: %w", err)
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return nil, false, fmt.Errorf("summarize history failed: empty summary")
+	}
+	slog.Debug("Compacted history", "summarized", cut, "kept", len(messages)-cut)
+
+	compacted := make([]*schema.Message, 0, len(messages)-cut+1)
+	compacted = append(compacted, types.NewHistorySummary(summary))
+	return append(compacted, messages[cut:]...), true, nil
+}
+
+func (c *HistoryCompactor) buildPrompt(ctx context.Context, summaries, older []*schema.Message) ([]*schema.Message, error) {
+	var sections []string
+	if c.FormState != nil {
+		state, err := c.FormState(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load form state failed: %w", err)
+		}
+		if state != "" {
+			sections = append(sections, fmt.Sprintf("# Current form state:\n%s", state))
+		}
+	}
+	for _, s := range summaries {
+		sections = append(sections, fmt.Sprintf("# Previous summary:\n%s", types.WrapMarkdownCodeBlock(s.Content, "")))
+	}
+	var buf strings.Builder
+	buf.WriteString("# Older messages:\n")
+	for _, msg := range older {
+		buf.WriteString("#### ")
+		buf.WriteString(string(msg.Role))
+		buf.WriteString(": \n")
+		buf.WriteString(types.WrapMarkdownCodeBlock(msg.Content, ""))
+		buf.WriteString("\n")
+	}
+	sections = append(sections, buf.String())
+	return []*schema.Message{
+		schema.SystemMessage(c.SystemPrompt),
+		schema.UserMessage(strings.Join(sections, "\n\n")),
+	}, nil
+}
+
+// CompactingHistoryStore compacts the history before it is saved. When summarization
+// fails the full history is saved and the error is only logged.
+type CompactingHistoryStore struct {
+	HistoryReadWriter
+	Compactor *HistoryCompactor
+}
+
+var _ HistoryReadWriter = (*CompactingHistoryStore)(nil)
+
+func NewCompactingHistoryStore(store HistoryReadWriter, compactor *HistoryCompactor) *CompactingHistoryStore {
+	return &CompactingHistoryStore{
+		HistoryReadWriter: store,
+		Compactor:         compactor,
+	}
+}
+
+func (s *CompactingHistoryStore) Save(ctx context.Context, history []*schema.Message) error {
+	return s.HistoryReadWriter.Save(ctx, s.compact(ctx, history))
+}
+
+func (s *CompactingHistoryStore) Append(ctx context.Context, messages ...*schema.Message) ([]*schema.Message, error) {
+	hist, err := s.HistoryReadWriter.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hist = s.compact(ctx, appendHistory(hist, messages...))
+	if err := s.HistoryReadWriter.Save(ctx, hist); err != nil {
+		return nil, err
+	}
+	return hist, nil
+}
+
+func (s *CompactingHistoryStore) compact(ctx context.Context, history []*schema.Message) []*schema.Message {
+	compacted, changed, err := s.Compactor.Compact(ctx, history)
+	if err != nil {
+		slog.Warn("History compaction failed", "error", err)
+		return history
+	}
+	if !changed {
+		return history
+	}
+	return compacted
+}
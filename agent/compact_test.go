@@ -0,0 +1,102 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/types"
+)
+
+func conversation(turns int) []*schema.Message {
+	var history []*schema.Message
+	for i := range turns {
+		history = append(history,
+			schema.UserMessage(fmt.Sprintf("user %d", i)),
+			schema.AssistantMessage(fmt.Sprintf("assistant %d", i), nil),
+		)
+	}
+	return history
+}
+
+func TestHistoryCompactor(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnText().WhenPromptContains("用户偏好").ReplyText("用户偏好电子发票；仍在等金额。")
+	m.OnText().ReplyText("用户偏好电子发票。")
+
+	compactor := agent.NewHistoryCompactor(m)
+	compactor.Threshold = 6
+	compactor.KeepRecent = 3
+	compactor.FormState = func(ctx context.Context) (string, error) {
+		return "title: 打车", nil
+	}
+	ctx := context.Background()
+
+	history, changed, err := compactor.Compact(ctx, conversation(3))
+	if err != nil || changed || len(history) != 6 {
+		t.Fatalf("short history should be left alone: %v %v", changed, err)
+	}
+
+	history, changed, err = compactor.Compact(ctx, conversation(5))
+	if err != nil || !changed {
+		t.Fatalf("expected compaction, got %v %v", changed, err)
+	}
+	// the kept window starts at the user message of turn 3
+	if len(history) != 5 || !types.IsHistorySummary(history[0]) || history[1].Content != "user 3" {
+		t.Fatalf("unexpected compacted history: %d messages, first %q", len(history), history[1].Content)
+	}
+	prompt := m.Calls()[0].Prompt()
+	if !strings.Contains(prompt, "title: 打车") || !strings.Contains(prompt, "user 0") || strings.Contains(prompt, "user 3") {
+		t.Fatalf("unexpected summarization prompt:\n%s", prompt)
+	}
+
+	history[0].Content = "用户偏好电子发票。"
+	history = append(history, conversation(2)...)
+	history, _, err = compactor.Compact(ctx, history)
+	if err != nil || history[0].Content != "用户偏好电子发票；仍在等金额。" {
+		t.Fatalf("previous summary should be folded in: %v", err)
+	}
+	if summaries, _ := types.SplitHistorySummary(history); len(summaries) != 1 {
+		t.Fatalf("expected a single summary, got %d", len(summaries))
+	}
+
+	rendered := types.FormatMessageHistory(history)
+	if !strings.HasPrefix(rendered, "# Summary of earlier conversation:\n```\n用户偏好电子发票；仍在等金额。\n```") {
+		t.Fatalf("summary not rendered as its own section:\n%s", rendered)
+	}
+}
+
+func TestCompactingHistoryStore(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnText().ReplyError(errors.New("model down")).ReplyText("摘要")
+	compactor := agent.NewHistoryCompactor(m)
+	compactor.Threshold = 4
+	compactor.KeepRecent = 2
+
+	ctx, keygen := testSession("s1")
+	inner := agent.NewHistoryStore(agent.NewStore[[]*schema.Message](agent.NewMemoryCore[[]*schema.Message](), "history", keygen))
+	store := agent.NewCompactingHistoryStore(inner, compactor)
+
+	if _, err := store.Append(ctx, conversation(3)...); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := inner.Load(ctx)
+	if len(saved) != 6 {
+		t.Fatalf("failed compaction should keep full history, got %d messages", len(saved))
+	}
+
+	hist, err := store.Append(ctx, schema.UserMessage("user 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ = inner.Load(ctx)
+	// KeepRecent is widened to start at the user message of the previous turn
+	if len(hist) != 4 || len(saved) != 4 || saved[0].Content != "摘要" || saved[1].Content != "user 2" {
+		t.Fatalf("unexpected saved history: %d messages", len(saved))
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"github.com/cloudwego/eino/adk"
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/patch"
+	"github.com/tbxark/formagent/types"
+)
+
+// Form events are sent by Agent.Run as adk.AgentAction.CustomizedAction values before
+// the message event when WithFormEvents is set.
+
+// IntentEvent reports the intent recognized for the turn.
+type IntentEvent struct {
+	Intent indent.Intent `json:"intent"`
+}
+
+// PatchEvent reports the operations applied to the form and the ones that were rejected.
+type PatchEvent struct {
+	Ops      []patch.Operation `json:"ops,omitempty"`
+	Rejected []patch.Rejection `json:"rejected,omitempty"`
+}
+
+// FormUpdatedEvent carries the form after the turn, so a UI can redraw it.
+type FormUpdatedEvent[T any] struct {
+	FormState        T                 `json:"form_state"`
+	Phase            types.Phase       `json:"phase"`
+	MissingFields    []types.FieldInfo `json:"missing_fields,omitempty"`
+	ValidationErrors []types.FieldInfo `json:"validation_errors,omitempty"`
+}
+
+// PhaseChangedEvent reports a phase transition.
+type PhaseChangedEvent struct {
+	From types.Phase `json:"from"`
+	To   types.Phase `json:"to"`
+}
+
+// WithFormEvents makes Run send IntentEvent, PatchEvent, FormUpdatedEvent and
+// PhaseChangedEvent before the reply. PatchEvent and PhaseChangedEvent are only sent
+// when something was patched or the phase changed.
+func WithFormEvents[T any]() AgentOption[T] {
+	return func(a *Agent[T]) {
+		a.formEvents = true
+	}
+}
+
+func (a *Agent[T]) formEventsFor(state *State[T], report *TurnReport) []*adk.AgentEvent {
+	if !a.formEvents || report == nil {
+		return nil
+	}
+	var actions []any
+	if report.Intent != "" {
+		actions = append(actions, &IntentEvent{Intent: report.Intent})
+	}
+	if len(report.Ops) > 0 || len(report.RejectedOps) > 0 {
+		actions = append(actions, &PatchEvent{Ops: report.Ops, Rejected: report.RejectedOps})
+	}
+	actions = append(actions, &FormUpdatedEvent[T]{
+		FormState:        state.FormState,
+		Phase:            state.Phase,
+		MissingFields:    report.MissingFields,
+		ValidationErrors: report.ValidationErrors,
+	})
+	if report.PreviousPhase != report.Phase {
+		actions = append(actions, &PhaseChangedEvent{From: report.PreviousPhase, To: report.Phase})
+	}
+	events := make([]*adk.AgentEvent, 0, len(actions))
+	for _, action := range actions {
+		events = append(events, &adk.AgentEvent{
+			AgentName: a.name,
+			Action:    &adk.AgentAction{CustomizedAction: action},
+		})
+	}
+	return events
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tbxark/formagent/types"
+)
+
+const fileCacheExt = ".json"
+
+// FileCache stores every key in its own JSON file in a directory, so values survive a
+// restart. Files are replaced with an atomic rename. CompareAndSet is only atomic among
+// users of the same FileCache, not across processes sharing the directory.
+type FileCache[S any] struct {
+	dir   string
+	codec Codec[S]
+	mu    sync.Mutex
+	// DefaultTTL is the TTL used by Set and CompareAndSet. Zero never expires.
+	DefaultTTL time.Duration
+	// Clock is used for expiration. Defaults to time.Now.
+	Clock types.Clock
+}
+
+// fileEntry is the content of a cache file. Values the codec encodes as JSON are kept
+// readable in Value, anything else goes to Data.
+type fileEntry struct {
+	Key       string          `json:"key"`
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+}
+
+var _ Cache[any] = (*FileCache[any])(nil)
+
+// NewFileCache creates dir if needed. A nil codec means JSONCodec.
+func NewFileCache[S any](dir string, codec Codec[S]) (*FileCache[S], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if codec == nil {
+		codec = JSONCodec[S]{}
+	}
+	return &FileCache[S]{dir: dir, codec: codec, Clock: time.Now}, nil
+}
+
+func (c *FileCache[S]) Set(ctx context.Context, key string, val S) error {
+	return c.SetWithTTL(ctx, key, val, c.DefaultTTL)
+}
+
+func (c *FileCache[S]) SetWithTTL(ctx context.Context, key string, val S, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(key, val, ttl)
+}
+
+func (c *FileCache[S]) Get(ctx context.Context, key string) (S, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read(key)
+}
+
+func (c *FileCache[S]) Del(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remove(key)
+}
+
+func (c *FileCache[S]) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok, err := c.Get(ctx, key)
+	return ok, err
+}
+
+func (c *FileCache[S]) CompareAndSet(ctx context.Context, key string, val S, match func(current S, ok bool) bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, ok, err := c.read(key)
+	if err != nil {
+		return false, err
+	}
+	if !match(current, ok) {
+		return false, nil
+	}
+	return true, c.write(key, val, c.DefaultTTL)
+}
+
+// DeleteExpired removes the files of expired entries.
+func (c *FileCache[S]) DeleteExpired(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+fileCacheExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		entry, err := readFileEntry(path)
+		if err != nil {
+			return err
+		}
+		if entry != nil && isExpired(c.Clock, entry.ExpiresAt) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to delete cache file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *FileCache[S]) path(key string) string {
+	return filepath.Join(c.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+fileCacheExt)
+}
+
+func (c *FileCache[S]) read(key string) (S, bool, error) {
+	var zero S
+	entry, err := readFileEntry(c.path(key))
+	if err != nil || entry == nil {
+		return zero, false, err
+	}
+	if isExpired(c.Clock, entry.ExpiresAt) {
+		return zero, false, c.remove(key)
+	}
+	data := entry.Data
+	if entry.Value != nil {
+		data = entry.Value
+	}
+	val, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false, fmt.Errorf("failed to decode cache value: %w", err)
+	}
+	return val, true, nil
+}
+
+func (c *FileCache[S]) write(key string, val S, ttl time.Duration) error {
+	data, err := c.codec.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache value: %w", err)
+	}
+	entry := fileEntry{Key: key, ExpiresAt: expiresAt(c.Clock, ttl)}
+	if json.Valid(data) {
+		entry.Value = data
+	} else {
+		entry.Data = data
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+func (c *FileCache[S]) remove(key string) error {
+	if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete cache file: %w", err)
+	}
+	return nil
+}
+
+func readFileEntry(path string) (*fileEntry, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	var entry fileEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache file %s: %w", filepath.Base(path), err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,98 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/types"
+)
+
+func TestFileCache_PersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx, keygen := testSession("user/1:a")
+	open := func() (*agent.StateStore[*expense], *agent.HistoryStore) {
+		states, err := agent.NewFileCache[*agent.State[*expense]](dir, nil)
+		if err != nil {
+			t.Fatalf("NewFileCache failed: %v", err)
+		}
+		history, err := agent.NewFileCache[[]*schema.Message](dir, nil)
+		if err != nil {
+			t.Fatalf("NewFileCache failed: %v", err)
+		}
+		return agent.NewStateStore[*expense](agent.NewStore[*agent.State[*expense]](states, "state", keygen), nil),
+			agent.NewHistoryStore(agent.NewStore[[]*schema.Message](history, "history", keygen))
+	}
+
+	store, history := open()
+	if err := store.Save(ctx, &agent.State[*expense]{Phase: types.PhaseConfirming, FormState: &expense{Title: "打车", Amount: 42}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := history.Append(ctx, schema.UserMessage("打车 42"), schema.AssistantMessage("请确认", nil)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	store, history = open()
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if state.Phase != types.PhaseConfirming || state.FormState.Amount != 42 || state.Version != 1 {
+		t.Fatalf("state after restart = %+v %+v", state, state.FormState)
+	}
+	if msgs, _ := history.Load(ctx); len(msgs) != 2 || msgs[1].Content != "请确认" {
+		t.Fatalf("history after restart = %v", msgs)
+	}
+	if err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{}}); !errors.Is(err, agent.ErrStateConflict) {
+		t.Fatalf("stale save error = %v, want conflict", err)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Fatalf("files after clear = %v, want only history", files)
+	}
+}
+
+func TestFileCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	cache, err := agent.NewFileCache[[]byte](dir, rawCodec{})
+	if err != nil {
+		t.Fatalf("NewFileCache failed: %v", err)
+	}
+	cache.Clock = func() time.Time { return now }
+	_ = cache.SetWithTTL(ctx, "short", []byte{0xff, 0x00}, time.Minute)
+	_ = cache.Set(ctx, "forever", []byte("plain"))
+
+	if val, ok, err := cache.Get(ctx, "short"); err != nil || !ok || len(val) != 2 || val[0] != 0xff {
+		t.Fatalf("Get(short) = %v, %v, %v", val, ok, err)
+	}
+	now = now.Add(time.Hour)
+	if ok, _ := cache.Exists(ctx, "short"); ok {
+		t.Fatal("entry did not expire")
+	}
+	_ = cache.SetWithTTL(ctx, "stale", []byte("x"), time.Second)
+	now = now.Add(time.Minute)
+	if err := cache.DeleteExpired(ctx); err != nil {
+		t.Fatalf("DeleteExpired failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("%d files after DeleteExpired, want 1", len(entries))
+	}
+	if val, ok, _ := cache.Get(ctx, "forever"); !ok || string(val) != "plain" {
+		t.Fatalf("Get(forever) = %q, %v", val, ok)
+	}
+}
+
+// rawCodec stores bytes as they are, which are not always valid JSON.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(val []byte) ([]byte, error)    { return val, nil }
+func (rawCodec) Unmarshal(data []byte) ([]byte, error) { return data, nil }
@@ -2,8 +2,11 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"time"
 
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
@@ -15,6 +18,15 @@ import (
 
 type FormFlow[T any] struct {
 	PatchHook         func(T, []patch.Operation) ([]patch.Operation, error)
+	PatchHistoryLimit int
+	PatchValidator    patch.Validator
+	StateInit         func(ctx context.Context) T
+	Transitions       PhaseTransitions
+	Submitter         Submitter[T]
+	// Clock and Location set the current date shown in prompts. A location attached
+	// with types.WithLocation takes precedence over Location.
+	Clock             types.Clock
+	Location          *time.Location
 	Spec              FormSpec[T]
 	PatchGenerator    patch.Generator[T]
 	DialogueGenerator dialogue.Generator[T]
@@ -22,12 +34,25 @@ type FormFlow[T any] struct {
 }
 
 func NewFormFlow[T any](spec FormSpec[T], patchGen patch.Generator[T], dialogGen dialogue.Generator[T], indentRecognizer indent.Recognizer[T]) *FormFlow[T] {
-	return &FormFlow[T]{
+	flow := &FormFlow[T]{
+		PatchHistoryLimit: patch.DefaultHistoryLimit,
+		Transitions:       DefaultPhaseTransitions(),
 		Spec:              spec,
 		PatchGenerator:    patchGen,
 		DialogueGenerator: dialogGen,
 		IndentRecognizer:  indentRecognizer,
 	}
+	if s, ok := spec.(interface{ InitState(ctx context.Context) T }); ok {
+		flow.StateInit = s.InitState
+	}
+	if s, ok := spec.(interface{ JSONSchema() string }); ok {
+		if validator, err := patch.NewSchemaValidatorFromJSON(s.JSONSchema()); err == nil {
+			flow.PatchValidator = validator
+		} else {
+			slog.Warn("Failed to build patch validator from form schema", "error", err)
+		}
+	}
+	return flow
 }
 
 func NewToolBasedFormFlow[T any](
@@ -52,28 +77,56 @@ func NewToolBasedFormFlow[T any](
 }
 
 func (a *FormFlow[T]) Invoke(ctx context.Context, input *Request[T]) (*Response[T], error) {
-	toolRequest := a.newToolRequest(ctx, input)
-	response, err := a.runInternal(ctx, toolRequest)
+	stateInit := a.stateInit(input)
+	toolRequest := a.newToolRequest(ctx, input, stateInit)
+	history := input.State.PatchHistory.Clone()
+	response, err := a.runInternal(ctx, toolRequest, history, stateInit)
 	if err != nil {
 		return nil, err
 	}
+	response.State.PatchHistory = history
+	response.State.Version = input.State.Version
+	response.Report = newTurnReport(input.State.Phase, toolRequest, response.State.Phase)
 	return response, nil
 }
 
 func (a *FormFlow[T]) Stream(ctx context.Context, input *Request[T]) (*StreamResponse[T], error) {
-	toolRequest := a.newToolRequest(ctx, input)
-	response, err := a.runInternalStream(ctx, toolRequest)
+	stateInit := a.stateInit(input)
+	toolRequest := a.newToolRequest(ctx, input, stateInit)
+	history := input.State.PatchHistory.Clone()
+	response, err := a.runInternalStream(ctx, toolRequest, history, stateInit)
 	if err != nil {
 		return nil, err
 	}
+	response.State.PatchHistory = history
+	response.State.Version = input.State.Version
+	response.Report = newTurnReport(input.State.Phase, toolRequest, response.State.Phase)
 	return response, nil
 }
 
-func (a *FormFlow[T]) newToolRequest(ctx context.Context, input *Request[T]) *types.ToolRequest[T] {
+// stateInit returns the flow's StateInit, falling back to the request's.
+func (a *FormFlow[T]) stateInit(input *Request[T]) func(ctx context.Context) T {
+	if a.StateInit != nil {
+		return a.StateInit
+	}
+	return input.StateInit
+}
+
+func (a *FormFlow[T]) newToolRequest(ctx context.Context, input *Request[T], stateInit func(ctx context.Context) T) *types.ToolRequest[T] {
 	if input.State.Phase == "" {
 		input.State.Phase = types.PhaseCollecting
 	}
+	if stateInit != nil && isNilForm(input.State.FormState) {
+		// patches cannot add fields to a null document
+		input.State.FormState = stateInit(ctx)
+	}
+	loc := a.Location
+	if l, ok := types.LocationFromContext(ctx); ok {
+		loc = l
+	}
 	return &types.ToolRequest[T]{
+		Clock:            a.Clock,
+		Location:         loc,
 		State:            input.State.FormState,
 		StateSummary:     a.Spec.Summary(ctx, input.State.FormState),
 		Phase:            input.State.Phase,
@@ -84,8 +137,8 @@ func (a *FormFlow[T]) newToolRequest(ctx context.Context, input *Request[T]) *ty
 	}
 }
 
-func (a *FormFlow[T]) runInternal(ctx context.Context, request *types.ToolRequest[T]) (*Response[T], error) {
-	commandResp, err := a.preprocessRequest(ctx, request)
+func (a *FormFlow[T]) runInternal(ctx context.Context, request *types.ToolRequest[T], history *patch.History, stateInit func(ctx context.Context) T) (*Response[T], error) {
+	commandResp, err := a.preprocessRequest(ctx, request, history, stateInit)
 	if err != nil {
 		return nil, err
 	}
@@ -107,11 +160,12 @@ func (a *FormFlow[T]) runInternal(ctx context.Context, request *types.ToolReques
 			Phase:     request.Phase,
 			FormState: request.State,
 		},
+		Metadata: requestMetadata(request),
 	}, nil
 }
 
-func (a *FormFlow[T]) runInternalStream(ctx context.Context, request *types.ToolRequest[T]) (*StreamResponse[T], error) {
-	commandResp, err := a.preprocessRequest(ctx, request)
+func (a *FormFlow[T]) runInternalStream(ctx context.Context, request *types.ToolRequest[T], history *patch.History, stateInit func(ctx context.Context) T) (*StreamResponse[T], error) {
+	commandResp, err := a.preprocessRequest(ctx, request, history, stateInit)
 	if err != nil {
 		return nil, err
 	}
@@ -135,10 +189,11 @@ func (a *FormFlow[T]) runInternalStream(ctx context.Context, request *types.Tool
 			Phase:     request.Phase,
 			FormState: request.State,
 		},
+		Metadata: requestMetadata(request),
 	}, nil
 }
 
-func (a *FormFlow[T]) preprocessRequest(ctx context.Context, request *types.ToolRequest[T]) (*Response[T], error) {
+func (a *FormFlow[T]) preprocessRequest(ctx context.Context, request *types.ToolRequest[T], history *patch.History, stateInit func(ctx context.Context) T) (*Response[T], error) {
 	// indent
 	slog.Debug("Parsing indent", "request", request.State)
 	cmd, err := a.IndentRecognizer.RecognizerIntent(ctx, request)
@@ -146,15 +201,19 @@ func (a *FormFlow[T]) preprocessRequest(ctx context.Context, request *types.Tool
 		return nil, err
 	}
 	slog.Debug("Parsed indent", "indent", cmd)
+	request.Extra["intent"] = cmd
 
 	switch cmd {
 	case indent.Confirm:
 		if len(request.MissingFields) == 0 && len(request.ValidationErrors) == 0 {
-			return a.handleCommand(cmd, request)
+			return a.transition(ctx, cmd, request)
 		}
 	case indent.Cancel:
-		return a.handleCommand(cmd, request)
+		return a.transition(ctx, cmd, request)
 	case indent.Edit:
+		if resp, tErr := a.transition(ctx, cmd, request); tErr != nil || resp != nil {
+			return resp, tErr
+		}
 		// patch
 		slog.Debug("Requesting patch generation")
 		updateArgs, pErr := a.PatchGenerator.GeneratePatch(ctx, request)
@@ -167,20 +226,78 @@ func (a *FormFlow[T]) preprocessRequest(ctx context.Context, request *types.Tool
 				return nil, pErr
 			}
 		}
-		if len(updateArgs.Ops) == 0 {
-			break
+		ops := updateArgs.Ops
+		var rejected []patch.Rejection
+		if a.PatchValidator != nil {
+			ops, rejected = a.PatchValidator.Validate(ops)
+		}
+		if len(ops) > 0 {
+			slog.Debug("Applying patch", "ops", ops)
+			newState, inverse, pErr := patch.ApplyRFC6902WithInverse(request.State, ops)
+			if pErr != nil {
+				slog.Warn("Failed to apply patch", "error", pErr)
+				for _, op := range ops {
+					rejected = append(rejected, patch.Rejection{Operation: op, Reason: pErr.Error()})
+				}
+			} else {
+				history.Push(patch.Record{Ops: ops, Inverse: inverse}, a.PatchHistoryLimit)
+				a.updateState(ctx, request, newState)
+				request.Extra["ops"] = ops
+			}
+		}
+		if len(rejected) > 0 {
+			slog.Debug("Rejected patch operations", "rejected", rejected)
+			for _, r := range rejected {
+				request.ValidationErrors = append(request.ValidationErrors, types.FieldInfo{
+					JSONPointer: r.Operation.Path,
+					Description: fmt.Sprintf("rejected %s operation: %s", r.Operation.Op, r.Reason),
+				})
+			}
+			request.Extra["rejected_ops"] = rejected
+		}
+	case indent.Undo, indent.Redo:
+		if resp, tErr := a.transition(ctx, cmd, request); tErr != nil || resp != nil {
+			return resp, tErr
 		}
-		slog.Debug("Applying patch", "ops", updateArgs.Ops)
-		newState, pErr := patch.ApplyRFC6902(request.State, updateArgs.Ops)
+		var ops []patch.Operation
+		if cmd == indent.Undo {
+			rec, ok := history.PopUndo()
+			if !ok {
+				request.Extra[string(cmd)] = "nothing to undo"
+				break
+			}
+			ops = rec.Inverse
+		} else {
+			rec, ok := history.PopRedo()
+			if !ok {
+				request.Extra[string(cmd)] = "nothing to redo"
+				break
+			}
+			ops = rec.Ops
+		}
+		slog.Debug("Applying patch history", "indent", cmd, "ops", ops)
+		newState, pErr := patch.ApplyRFC6902(request.State, ops)
 		if pErr != nil {
 			return nil, pErr
 		}
-		// update state
-		request.State = newState
-		request.StateSummary = a.Spec.Summary(ctx, request.State)
-		request.MissingFields = a.Spec.MissingFacts(ctx, request.State)
-		request.ValidationErrors = a.Spec.ValidateFacts(ctx, request.State)
-		request.Extra["ops"] = updateArgs.Ops
+		a.updateState(ctx, request, newState)
+		request.Extra["ops"] = ops
+	case indent.Reset:
+		if resp, tErr := a.transition(ctx, cmd, request); tErr != nil || resp != nil {
+			return resp, tErr
+		}
+		if request.Phase != types.PhaseCollecting {
+			break
+		}
+		var initial T
+		if stateInit != nil {
+			initial = stateInit(ctx)
+		}
+		slog.Debug("Resetting form state")
+		a.updateState(ctx, request, initial)
+		history.Undo = nil
+		history.Redo = nil
+		request.Extra[string(cmd)] = "form state was cleared"
 	case indent.DoNothing:
 		break
 	}
@@ -188,24 +305,139 @@ func (a *FormFlow[T]) preprocessRequest(ctx context.Context, request *types.Tool
 	return nil, nil
 }
 
-func (a *FormFlow[T]) handleCommand(cmd indent.Intent, request *types.ToolRequest[T]) (*Response[T], error) {
+func (a *FormFlow[T]) updateState(ctx context.Context, request *types.ToolRequest[T], newState T) {
+	request.State = newState
+	request.StateSummary = a.Spec.Summary(ctx, request.State)
+	request.MissingFields = a.Spec.MissingFacts(ctx, request.State)
+	request.ValidationErrors = a.Spec.ValidateFacts(ctx, request.State)
+}
+
+func (a *FormFlow[T]) transition(ctx context.Context, cmd indent.Intent, request *types.ToolRequest[T]) (*Response[T], error) {
+	transitions := a.Transitions
+	if transitions == nil {
+		transitions = DefaultPhaseTransitions()
+	}
+	next, ok := transitions.Next(request.Phase, cmd)
+	if !ok {
+		return nil, nil
+	}
+	slog.Debug("Phase transition", "from", request.Phase, "to", next, "indent", cmd)
+	if IsTerminalPhase(next) {
+		return a.handleCommand(ctx, next, request)
+	}
+	request.Phase = next
+	return nil, nil
+}
+
+func (a *FormFlow[T]) handleCommand(ctx context.Context, next types.Phase, request *types.ToolRequest[T]) (*Response[T], error) {
 	resp := &Response[T]{
 		Message: "",
 		State: &State[T]{
-			Phase:     request.Phase,
+			Phase:     next,
 			FormState: request.State,
 		},
 		Metadata: map[string]string{},
 	}
-	switch cmd {
-	case indent.Cancel:
+	switch next {
+	case types.PhaseCancelled:
 		resp.Message = "表单填写已取消。"
-		resp.State.Phase = types.PhaseCancelled
-	case indent.Confirm:
+	case types.PhaseSubmitted:
+		receipt, err := a.submit(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if receipt == nil {
+			// submission failed, let the dialogue explain the error
+			return nil, nil
+		}
 		resp.Message = "表单已成功提交，谢谢！"
-		resp.State.Phase = types.PhaseConfirmed
+		if receipt.Message != "" {
+			resp.Message = receipt.Message
+		} else if receipt.ID != "" {
+			resp.Message = fmt.Sprintf("表单已成功提交，编号：%s，谢谢！", receipt.ID)
+		}
+		for k, v := range receipt.Metadata {
+			resp.Metadata[k] = v
+		}
+		if receipt.ID != "" {
+			resp.Metadata["receipt_id"] = receipt.ID
+		}
 	default:
 		return resp, nil
 	}
 	return resp, nil
 }
+
+func (a *FormFlow[T]) submitter() Submitter[T] {
+	if a.Submitter != nil {
+		return a.Submitter
+	}
+	if s, ok := a.Spec.(Submitter[T]); ok {
+		return s
+	}
+	return nil
+}
+
+// submit returns a nil receipt when the submission was rejected; the request is then
+// moved to PhaseSubmitFailed with the error recorded as a validation error.
+func (a *FormFlow[T]) submit(ctx context.Context, request *types.ToolRequest[T]) (*Receipt, error) {
+	submitter := a.submitter()
+	if submitter == nil {
+		return &Receipt{}, nil
+	}
+	slog.Debug("Submitting form")
+	request.Extra["submitted"] = true
+	receipt, err := submitter.Submit(ctx, request.State)
+	if err == nil {
+		if receipt == nil {
+			receipt = &Receipt{}
+		}
+		return receipt, nil
+	}
+	slog.Warn("Form submission failed", "error", err)
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	var submitErr *SubmitError
+	if errors.As(err, &submitErr) && len(submitErr.Fields) > 0 {
+		request.ValidationErrors = append(request.ValidationErrors, submitErr.Fields...)
+	} else {
+		request.ValidationErrors = append(request.ValidationErrors, types.FieldInfo{
+			Description: fmt.Sprintf("提交失败：%v", err),
+		})
+	}
+	request.Phase = types.PhaseSubmitFailed
+	request.Extra["submit_error"] = err.Error()
+	return nil, nil
+}
+
+// isNilForm reports whether form is a nil map, pointer, slice or interface.
+func isNilForm[T any](form T) bool {
+	v := reflect.ValueOf(&form).Elem()
+	switch v.Kind() {
+	case reflect.Map, reflect.Pointer, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func requestMetadata[T any](request *types.ToolRequest[T]) map[string]string {
+	if msg, ok := request.Extra["submit_error"].(string); ok {
+		return map[string]string{"submit_error": msg}
+	}
+	return nil
+}
+
+func newTurnReport[T any](previous types.Phase, request *types.ToolRequest[T], phase types.Phase) *TurnReport {
+	report := &TurnReport{
+		PreviousPhase:    previous,
+		Phase:            phase,
+		MissingFields:    request.MissingFields,
+		ValidationErrors: request.ValidationErrors,
+	}
+	report.Intent, _ = request.Extra["intent"].(indent.Intent)
+	report.Ops, _ = request.Extra["ops"].([]patch.Operation)
+	report.RejectedOps, _ = request.Extra["rejected_ops"].([]patch.Rejection)
+	report.Submitted, _ = request.Extra["submitted"].(bool)
+	return report
+}
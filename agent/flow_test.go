@@ -0,0 +1,297 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/types"
+)
+
+type expense struct {
+	Title  string  `json:"title,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+}
+
+type expenseSpec struct{}
+
+func (expenseSpec) Summary(ctx context.Context, current *expense) string {
+	return "title=" + current.Title
+}
+
+func (expenseSpec) MissingFacts(ctx context.Context, current *expense) []types.FieldInfo {
+	var missing []types.FieldInfo
+	if current.Title == "" {
+		missing = append(missing, types.FieldInfo{JSONPointer: "/title", DisplayName: "标题", Required: true})
+	}
+	if current.Amount == 0 {
+		missing = append(missing, types.FieldInfo{JSONPointer: "/amount", DisplayName: "金额", Required: true})
+	}
+	return missing
+}
+
+func (expenseSpec) ValidateFacts(ctx context.Context, current *expense) []types.FieldInfo {
+	return nil
+}
+
+func newTestFlow(t *testing.T, m *formagenttest.FakeChatModel) *agent.FormFlow[*expense] {
+	t.Helper()
+	flow, err := agent.NewToolBasedFormFlow[*expense](expenseSpec{}, m)
+	if err != nil {
+		t.Fatalf("NewToolBasedFormFlow failed: %v", err)
+	}
+	return flow
+}
+
+func turn(t *testing.T, flow *agent.FormFlow[*expense], state *agent.State[*expense], message string) *agent.Response[*expense] {
+	t.Helper()
+	resp, err := flow.Invoke(context.Background(), &agent.Request[*expense]{
+		State:       state,
+		ChatHistory: []*schema.Message{schema.UserMessage(message)},
+	})
+	if err != nil {
+		t.Fatalf("Invoke(%q) failed: %v", message, err)
+	}
+	return resp
+}
+
+func TestFormFlow_ConfirmTwiceToSubmit(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").WhenUserSays("打车 42").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("parse_intent").WhenUserSays("改成 50").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnTool("update_form").WhenUserSays("打车 42").
+		ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"},{"op":"add","path":"/amount","value":42}]}`)
+	m.OnTool("update_form").WhenUserSays("改成 50").
+		ReplyToolCall(`{"ops":[{"op":"replace","path":"/amount","value":50}]}`)
+	m.OnText().ReplyText("请确认")
+
+	flow := newTestFlow(t, m)
+	var submitted *expense
+	flow.Submitter = agent.SubmitterFunc[*expense](func(ctx context.Context, current *expense) (*agent.Receipt, error) {
+		submitted = current
+		return &agent.Receipt{ID: "INV-1"}, nil
+	})
+
+	resp := turn(t, flow, &agent.State[*expense]{FormState: &expense{}}, "打车 42")
+	if resp.State.Phase != types.PhaseCollecting || resp.State.FormState.Amount != 42 {
+		t.Fatalf("unexpected state after edit: %+v %+v", resp.State, resp.State.FormState)
+	}
+
+	resp = turn(t, flow, resp.State, "确认")
+	if resp.State.Phase != types.PhaseConfirming || submitted != nil {
+		t.Fatalf("first confirmation should only move to confirming, got %s", resp.State.Phase)
+	}
+
+	resp = turn(t, flow, resp.State, "改成 50")
+	if resp.State.Phase != types.PhaseCollecting || resp.State.FormState.Amount != 50 {
+		t.Fatalf("edit while confirming should go back to collecting: %+v", resp.State)
+	}
+
+	resp = turn(t, flow, resp.State, "确认")
+	resp = turn(t, flow, resp.State, "确认提交")
+	if resp.State.Phase != types.PhaseSubmitted || submitted == nil || submitted.Amount != 50 {
+		t.Fatalf("expected submission, got phase %s", resp.State.Phase)
+	}
+	if resp.Metadata["receipt_id"] != "INV-1" {
+		t.Fatalf("receipt not surfaced in metadata: %+v", resp.Metadata)
+	}
+}
+
+func TestFormFlow_AcknowledgementDoesNotSubmit(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnText().ReplyText("请确认")
+	flow := newTestFlow(t, m)
+	flow.IndentRecognizer = indent.NewLocalIntentRecognizer[*expense]()
+	submitted := false
+	flow.Submitter = agent.SubmitterFunc[*expense](func(ctx context.Context, current *expense) (*agent.Receipt, error) {
+		submitted = true
+		return &agent.Receipt{ID: "INV-1"}, nil
+	})
+
+	state := &agent.State[*expense]{FormState: &expense{Title: "打车", Amount: 42}}
+	resp := turn(t, flow, state, "好")
+	resp = turn(t, flow, resp.State, "好")
+	if submitted || resp.State.Phase == types.PhaseSubmitted {
+		t.Fatalf("acknowledgements submitted the form, phase %s", resp.State.Phase)
+	}
+
+	resp = turn(t, flow, resp.State, "确认")
+	resp = turn(t, flow, resp.State, "好")
+	if submitted || resp.State.Phase != types.PhaseConfirming {
+		t.Fatalf("acknowledgement while confirming submitted the form, phase %s", resp.State.Phase)
+	}
+	resp = turn(t, flow, resp.State, "提交")
+	if !submitted || resp.State.Phase != types.PhaseSubmitted {
+		t.Fatalf("explicit confirmation did not submit, phase %s", resp.State.Phase)
+	}
+}
+
+func TestFormFlow_RetriesUnknownIntent(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"submit"}`).ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnText().ReplyText("请确认")
+	flow := newTestFlow(t, m)
+	recognizer, err := indent.NewToolBasedIntentRecognizer[*expense](m, indent.WithIntentMaxAttempts[*expense](2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow.IndentRecognizer = recognizer
+
+	state := &agent.State[*expense]{FormState: &expense{Title: "打车", Amount: 42}}
+	resp := turn(t, flow, state, "确认")
+	if resp.Report.Intent != indent.Confirm || resp.State.Phase != types.PhaseConfirming {
+		t.Fatalf("intent = %q, phase %s", resp.Report.Intent, resp.State.Phase)
+	}
+	calls := m.CallsFor("parse_intent")
+	if len(calls) != 2 || !strings.Contains(calls[1].Prompt(), `unknown intent "submit"`) {
+		t.Fatalf("unknown intent not retried with feedback, %d calls", len(calls))
+	}
+}
+
+func TestFormFlow_SubmitFailure(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnText().ReplyText("提交失败了")
+	flow := newTestFlow(t, m)
+	flow.Submitter = agent.SubmitterFunc[*expense](func(ctx context.Context, current *expense) (*agent.Receipt, error) {
+		return nil, errors.New("upstream unavailable")
+	})
+
+	state := &agent.State[*expense]{Phase: types.PhaseConfirming, FormState: &expense{Title: "打车", Amount: 42}}
+	resp := turn(t, flow, state, "确认")
+	if resp.State.Phase != types.PhaseSubmitFailed {
+		t.Fatalf("phase = %s, want submit_failed", resp.State.Phase)
+	}
+	dialogue := m.CallsFor("")
+	if len(dialogue) != 1 || !strings.Contains(dialogue[0].Prompt(), "upstream unavailable") {
+		t.Fatal("submit error should be fed back into the dialogue prompt")
+	}
+}
+
+func TestFormFlow_UndoAndReset(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").WhenUserSays("撤回").ReplyToolCall(`{"intent":"undo"}`)
+	m.OnTool("parse_intent").WhenUserSays("重新开始").ReplyToolCall(`{"intent":"reset"}`)
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"午餐"}]}`)
+	m.OnText().WhenUserSays("重新开始").ReplyText("表单已清空，这次要报销什么？")
+	m.OnText().ReplyText("好的")
+	flow := newTestFlow(t, m)
+	flow.StateInit = func(ctx context.Context) *expense {
+		return &expense{}
+	}
+
+	resp := turn(t, flow, &agent.State[*expense]{FormState: &expense{}}, "撤回")
+	if prompt := m.CallsFor("")[0].Prompt(); !strings.Contains(prompt, "undo: nothing to undo") {
+		t.Fatalf("undo note not in dialogue prompt:\n%s", prompt)
+	}
+	resp = turn(t, flow, resp.State, "午餐")
+	if resp.State.FormState.Title != "午餐" || len(resp.State.PatchHistory.Undo) != 1 {
+		t.Fatalf("edit not recorded: %+v", resp.State)
+	}
+	resp = turn(t, flow, resp.State, "撤回")
+	if resp.State.FormState.Title != "" || len(resp.State.PatchHistory.Redo) != 1 {
+		t.Fatalf("undo failed: %+v", resp.State.FormState)
+	}
+
+	resp = turn(t, flow, resp.State, "午餐")
+	resp = turn(t, flow, resp.State, "重新开始")
+	if resp.State.FormState == nil || resp.State.FormState.Title != "" || resp.State.Phase != types.PhaseCollecting {
+		t.Fatalf("reset failed: %+v", resp.State)
+	}
+	if len(resp.State.PatchHistory.Undo) != 0 || len(resp.State.PatchHistory.Redo) != 0 {
+		t.Fatalf("reset kept patch history: %+v", resp.State.PatchHistory)
+	}
+	if resp.Message != "表单已清空，这次要报销什么？" {
+		t.Fatalf("reset reply = %q, want generated dialogue", resp.Message)
+	}
+	dialogue := m.CallsFor("")
+	prompt := dialogue[len(dialogue)-1].Prompt()
+	if !strings.Contains(prompt, "**collecting**") || strings.Contains(prompt, "title=午餐") || !strings.Contains(prompt, "reset: form state was cleared") {
+		t.Fatalf("dialogue not generated from the reset state:\n%s", prompt)
+	}
+}
+
+func TestAgent_RunStream(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.ChunkSize = 2
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"打车"}]}`)
+	m.OnText().ReplyStream("请问", "金额是多少？")
+	flow := newTestFlow(t, m)
+
+	ctx, keygen := testSession("s1")
+	store := agent.NewStateStore[*expense](
+		agent.NewStore[*agent.State[*expense]](agent.NewMemoryCore[*agent.State[*expense]](), "test", keygen),
+		func(ctx context.Context) *expense { return &expense{} },
+	)
+	a := agent.NewAgent("test", "test agent", flow, store)
+
+	iter := a.Run(ctx, &adk.AgentInput{
+		Messages:        []adk.Message{schema.UserMessage("打车")},
+		EnableStreaming: true,
+	})
+	var content strings.Builder
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if event.Err != nil {
+			t.Fatalf("agent error: %v", event.Err)
+		}
+		if event.Output == nil || event.Output.MessageOutput == nil {
+			continue
+		}
+		stream := event.Output.MessageOutput.MessageStream
+		for {
+			msg, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("stream error: %v", err)
+			}
+			content.WriteString(msg.Content)
+		}
+	}
+	if content.String() != "请问金额是多少？" {
+		t.Fatalf("streamed content = %q", content.String())
+	}
+	state, err := store.Load(ctx)
+	if err != nil || state.FormState.Title != "打车" {
+		t.Fatalf("state not saved: %+v, %v", state, err)
+	}
+}
+
+func TestFormFlow_PinnedClockAndLocation(t *testing.T) {
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"do_nothing"}`)
+	m.OnText().ReplyText("好的")
+	flow := newTestFlow(t, m)
+	flow.Clock = types.FixedClock(time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC))
+	flow.Location = time.UTC
+
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+	ctx := types.WithLocation(context.Background(), shanghai)
+	_, err := flow.Invoke(ctx, &agent.Request[*expense]{
+		State:       &agent.State[*expense]{FormState: &expense{}},
+		ChatHistory: []*schema.Message{schema.UserMessage("昨天的")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2025-03-02T07:30:00+08:00 (Sunday, Asia/Shanghai)"
+	if prompt := m.CallsFor("parse_intent")[0].Prompt(); !strings.Contains(prompt, want) {
+		t.Fatalf("prompt does not contain %q:\n%s", want, prompt)
+	}
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSessionBusy is returned by SessionLocker.Lock when too many turns of the session
+// are already waiting.
+var ErrSessionBusy = errors.New("session busy: too many queued turns")
+
+// SessionLocker gives one turn at a time exclusive access to a session. Implementations
+// backed by a shared store let several processes serve the same sessions.
+type SessionLocker interface {
+	// Lock blocks until the session identified by key is free or ctx is done. The
+	// returned function releases the session and is called exactly once.
+	Lock(ctx context.Context, key string) (unlock func() error, err error)
+}
+
+// MemorySessionLocker queues turns of the same session in process while different
+// sessions proceed in parallel.
+type MemorySessionLocker struct {
+	maxQueue int
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	ch chan struct{}
+	// refs counts the holder and the waiters.
+	refs int
+}
+
+var _ SessionLocker = (*MemorySessionLocker)(nil)
+
+// NewMemorySessionLocker creates a locker that lets at most maxQueue turns wait for a
+// session; further turns fail with ErrSessionBusy. Zero means no limit.
+func NewMemorySessionLocker(maxQueue int) *MemorySessionLocker {
+	return &MemorySessionLocker{
+		maxQueue: maxQueue,
+		locks:    make(map[string]*sessionLock),
+	}
+}
+
+func (l *MemorySessionLocker) Lock(ctx context.Context, key string) (func() error, error) {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &sessionLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	if l.maxQueue > 0 && lock.refs > l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrSessionBusy
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	select {
+	case lock.ch <- struct{}{}:
+	case <-ctx.Done():
+		l.unref(key, lock)
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			<-lock.ch
+			l.unref(key, lock)
+		})
+		return nil
+	}, nil
+}
+
+func (l *MemorySessionLocker) unref(key string, lock *sessionLock) {
+	l.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+	l.mu.Unlock()
+}
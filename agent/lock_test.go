@@ -0,0 +1,94 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tbxark/formagent/agent"
+)
+
+func TestMemorySessionLocker(t *testing.T) {
+	ctx := context.Background()
+	locker := agent.NewMemorySessionLocker(1)
+	unlock, err := locker.Lock(ctx, "s1")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if other, err := locker.Lock(ctx, "s2"); err != nil {
+		t.Fatalf("other session blocked: %v", err)
+	} else {
+		_ = other()
+	}
+
+	acquired := make(chan func() error)
+	go func() {
+		next, err := locker.Lock(ctx, "s1")
+		if err != nil {
+			t.Errorf("queued Lock failed: %v", err)
+		}
+		acquired <- next
+	}()
+	// wait until the turn above is queued; a cancelled probe never waits itself
+	probe, cancelProbe := context.WithCancel(ctx)
+	cancelProbe()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := locker.Lock(probe, "s1"); errors.Is(err, agent.ErrSessionBusy) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queue limit not enforced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-acquired:
+		t.Fatal("session locked twice")
+	default:
+	}
+	_ = unlock()
+	next := <-acquired
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(waitCtx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock with expired context = %v, want deadline exceeded", err)
+	}
+	_ = next()
+	if again, err := locker.Lock(ctx, "s1"); err != nil {
+		t.Fatalf("Lock after release failed: %v", err)
+	} else {
+		_ = again()
+	}
+}
+
+// cacheLocker stands in for a distributed lock: it polls a shared cache with
+// compare-and-set.
+type cacheLocker struct {
+	cache agent.Cache[string]
+	token string
+}
+
+func (l *cacheLocker) Lock(ctx context.Context, key string) (func() error, error) {
+	free := func(current string, ok bool) bool { return !ok || current == "" }
+	for {
+		locked, err := l.cache.CompareAndSet(ctx, key, l.token, free)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return func() error {
+				_, err := l.cache.CompareAndSet(ctx, key, "", func(current string, ok bool) bool { return current == l.token })
+				return err
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/types"
+)
+
+// PhaseTransitions maps the current phase and the recognized intent to the next phase.
+// Intents without an entry leave the phase unchanged.
+type PhaseTransitions map[types.Phase]map[indent.Intent]types.Phase
+
+// DefaultPhaseTransitions requires two confirmations before a form is submitted:
+// the first moves a complete form into the confirming phase, where the summary is
+// reviewed, and only a second confirmation submits it. Edits while confirming send
+// the form back to collecting. A failed submission can be retried with another
+// confirmation or fixed with an edit.
+func DefaultPhaseTransitions() PhaseTransitions {
+	return PhaseTransitions{
+		types.PhaseCollecting: {
+			indent.Confirm: types.PhaseConfirming,
+			indent.Reset:   types.PhaseCollecting,
+			indent.Cancel:  types.PhaseCancelled,
+		},
+		types.PhaseConfirming: {
+			indent.Confirm: types.PhaseSubmitted,
+			indent.Edit:    types.PhaseCollecting,
+			indent.Undo:    types.PhaseCollecting,
+			indent.Redo:    types.PhaseCollecting,
+			indent.Reset:   types.PhaseCollecting,
+			indent.Cancel:  types.PhaseCancelled,
+		},
+		types.PhaseSubmitFailed: {
+			indent.Confirm: types.PhaseSubmitted,
+			indent.Edit:    types.PhaseCollecting,
+			indent.Undo:    types.PhaseCollecting,
+			indent.Redo:    types.PhaseCollecting,
+			indent.Reset:   types.PhaseCollecting,
+			indent.Cancel:  types.PhaseCancelled,
+		},
+	}
+}
+
+func (t PhaseTransitions) Next(phase types.Phase, intent indent.Intent) (types.Phase, bool) {
+	next, ok := t[phase][intent]
+	return next, ok
+}
+
+func IsTerminalPhase(phase types.Phase) bool {
+	return phase == types.PhaseSubmitted || phase == types.PhaseCancelled || phase == types.PhaseConfirmed
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/tbxark/formagent/types"
+)
+
+var sqlTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLCache stores values in a table of a SQL database. The statements use "?"
+// placeholders and INSERT ... ON CONFLICT as supported by SQLite; the caller opens the
+// database with a driver of their choice, or uses package sqlitecache.
+type SQLCache[S any] struct {
+	db    *sql.DB
+	table string
+	codec Codec[S]
+	// DefaultTTL is the TTL used by Set and CompareAndSet. Zero never expires.
+	DefaultTTL time.Duration
+	// Clock is used for expiration. Defaults to time.Now.
+	Clock types.Clock
+}
+
+var _ Cache[any] = (*SQLCache[any])(nil)
+
+// NewSQLCache creates table if it does not exist. A nil codec means JSONCodec.
+func NewSQLCache[S any](ctx context.Context, db *sql.DB, table string, codec Codec[S]) (*SQLCache[S], error) {
+	if !sqlTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid cache table name %q", table)
+	}
+	if codec == nil {
+		codec = JSONCodec[S]{}
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	cache_key TEXT PRIMARY KEY,
+	cache_value BLOB NOT NULL,
+	expires_at INTEGER NOT NULL DEFAULT 0
+)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache table: %w", err)
+	}
+	return &SQLCache[S]{db: db, table: table, codec: codec, Clock: time.Now}, nil
+}
+
+func (c *SQLCache[S]) Set(ctx context.Context, key string, val S) error {
+	return c.SetWithTTL(ctx, key, val, c.DefaultTTL)
+}
+
+func (c *SQLCache[S]) SetWithTTL(ctx context.Context, key string, val S, ttl time.Duration) error {
+	data, err := c.codec.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache value: %w", err)
+	}
+	_, err = c.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (cache_key, cache_value, expires_at) VALUES (?, ?, ?)
+ON CONFLICT(cache_key) DO UPDATE SET cache_value = excluded.cache_value, expires_at = excluded.expires_at`, c.table),
+		key, data, expiresAt(c.Clock, ttl))
+	if err != nil {
+		return fmt.Errorf("failed to set cache value: %w", err)
+	}
+	return nil
+}
+
+func (c *SQLCache[S]) Get(ctx context.Context, key string) (S, bool, error) {
+	var zero S
+	data, ok, err := c.get(ctx, key)
+	if err != nil || !ok {
+		return zero, false, err
+	}
+	val, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false, fmt.Errorf("failed to decode cache value: %w", err)
+	}
+	return val, true, nil
+}
+
+func (c *SQLCache[S]) Del(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE cache_key = ?`, c.table), key)
+	if err != nil {
+		return fmt.Errorf("failed to delete cache value: %w", err)
+	}
+	return nil
+}
+
+func (c *SQLCache[S]) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok, err := c.get(ctx, key)
+	return ok, err
+}
+
+// CompareAndSet reads and writes in one transaction; the write only succeeds if the
+// row still holds the value that was read.
+func (c *SQLCache[S]) CompareAndSet(ctx context.Context, key string, val S, match func(current S, ok bool) bool) (bool, error) {
+	data, err := c.codec.Marshal(val)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode cache value: %w", err)
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var old []byte
+	var oldExpiresAt int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT cache_value, expires_at FROM %s WHERE cache_key = ?`, c.table), key).Scan(&old, &oldExpiresAt)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get cache value: %w", err)
+	}
+	var current S
+	live := exists && !isExpired(c.Clock, oldExpiresAt)
+	if live {
+		if current, err = c.codec.Unmarshal(old); err != nil {
+			return false, fmt.Errorf("failed to decode cache value: %w", err)
+		}
+	}
+	if !match(current, live) {
+		return false, nil
+	}
+
+	var result sql.Result
+	expires := expiresAt(c.Clock, c.DefaultTTL)
+	if exists {
+		result, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET cache_value = ?, expires_at = ? WHERE cache_key = ? AND cache_value = ? AND expires_at = ?`, c.table),
+			data, expires, key, old, oldExpiresAt)
+	} else {
+		result, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (cache_key, cache_value, expires_at) VALUES (?, ?, ?) ON CONFLICT(cache_key) DO NOTHING`, c.table),
+			key, data, expires)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set cache value: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit cache value: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteExpired removes expired rows.
+func (c *SQLCache[S]) DeleteExpired(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE expires_at != 0 AND expires_at <= ?`, c.table), c.Clock().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired cache values: %w", err)
+	}
+	return nil
+}
+
+func (c *SQLCache[S]) get(ctx context.Context, key string) ([]byte, bool, error) {
+	var data []byte
+	var expires int64
+	err := c.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT cache_value, expires_at FROM %s WHERE cache_key = ?`, c.table), key).Scan(&data, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get cache value: %w", err)
+	}
+	if isExpired(c.Clock, expires) {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
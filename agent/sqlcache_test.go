@@ -0,0 +1,109 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/agent/sqlitecache"
+	"github.com/tbxark/formagent/types"
+)
+
+func TestSQLCache_PersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	ctx, keygen := testSession("user/1:a")
+	open := func() (*agent.StateStore[*expense], *agent.HistoryStore) {
+		states, err := sqlitecache.Open[*agent.State[*expense]](ctx, path, "states", nil)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		history, err := sqlitecache.Open[[]*schema.Message](ctx, path, "history", nil)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = states.Close()
+			_ = history.Close()
+		})
+		return agent.NewStateStore[*expense](agent.NewStore[*agent.State[*expense]](states, "state", keygen), nil),
+			agent.NewHistoryStore(agent.NewStore[[]*schema.Message](history, "history", keygen))
+	}
+
+	store, history := open()
+	if err := store.Save(ctx, &agent.State[*expense]{Phase: types.PhaseConfirming, FormState: &expense{Title: "打车", Amount: 42}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := history.Append(ctx, schema.UserMessage("打车 42"), schema.AssistantMessage("请确认", nil)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	store, history = open()
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if state.Phase != types.PhaseConfirming || state.FormState.Amount != 42 || state.Version != 1 {
+		t.Fatalf("state after restart = %+v %+v", state, state.FormState)
+	}
+	if msgs, _ := history.Load(ctx); len(msgs) != 2 || msgs[1].Content != "请确认" {
+		t.Fatalf("history after restart = %v", msgs)
+	}
+	if err := store.Save(ctx, &agent.State[*expense]{FormState: &expense{}}); !errors.Is(err, agent.ErrStateConflict) {
+		t.Fatalf("stale save error = %v, want conflict", err)
+	}
+	state.FormState.Amount = 50
+	if err := store.Save(ctx, state); err != nil || state.Version != 2 {
+		t.Fatalf("save of loaded state = %v, version %d", err, state.Version)
+	}
+	if err := store.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if state, _ := store.Load(ctx); state.Version != 0 || state.FormState != nil {
+		t.Fatalf("state after clear = %+v", state)
+	}
+}
+
+func TestSQLCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache, err := sqlitecache.Open[[]byte](ctx, filepath.Join(t.TempDir(), "cache.db"), "raw", rawCodec{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer cache.Close()
+	cache.Clock = func() time.Time { return now }
+	_ = cache.SetWithTTL(ctx, "short", []byte{0xff, 0x00}, time.Minute)
+	_ = cache.Set(ctx, "forever", []byte("plain"))
+	_ = cache.Set(ctx, "forever", []byte("updated"))
+
+	if val, ok, err := cache.Get(ctx, "short"); err != nil || !ok || len(val) != 2 || val[0] != 0xff {
+		t.Fatalf("Get(short) = %v, %v, %v", val, ok, err)
+	}
+	now = now.Add(time.Hour)
+	if ok, _ := cache.Exists(ctx, "short"); ok {
+		t.Fatal("entry did not expire")
+	}
+	// an expired row is replaced as if it were absent
+	saved, err := cache.CompareAndSet(ctx, "short", []byte("new"), func(current []byte, ok bool) bool { return !ok })
+	if err != nil || !saved {
+		t.Fatalf("CompareAndSet over expired row = %v, %v", saved, err)
+	}
+	_ = cache.SetWithTTL(ctx, "stale", []byte("x"), time.Second)
+	now = now.Add(time.Minute)
+	if err := cache.DeleteExpired(ctx); err != nil {
+		t.Fatalf("DeleteExpired failed: %v", err)
+	}
+	if ok, _ := cache.Exists(ctx, "stale"); ok {
+		t.Fatal("expired row not deleted")
+	}
+	if val, ok, _ := cache.Get(ctx, "forever"); !ok || string(val) != "updated" {
+		t.Fatalf("Get(forever) = %q, %v", val, ok)
+	}
+	if val, ok, _ := cache.Get(ctx, "short"); !ok || string(val) != "new" {
+		t.Fatalf("Get(short) = %q, %v", val, ok)
+	}
+}
@@ -0,0 +1,42 @@
+// Package sqlitecache opens agent.SQLCache on a SQLite file with the embedded pure-Go
+// driver from modernc.org/sqlite, registered as "sqlite". Programs that register
+// another driver under that name should use agent.NewSQLCache with their own *sql.DB.
+package sqlitecache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/tbxark/formagent/agent"
+	_ "modernc.org/sqlite"
+)
+
+// Cache is an agent.SQLCache that owns its database.
+type Cache[S any] struct {
+	*agent.SQLCache[S]
+	db *sql.DB
+}
+
+// Open opens or creates the SQLite database file at path and stores values in table.
+// Several caches may share one file with different tables. A nil codec means
+// agent.JSONCodec.
+func Open[S any](ctx context.Context, path, table string, codec agent.Codec[S]) (*Cache[S], error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// one connection serializes the writers of this cache
+	db.SetMaxOpenConns(1)
+	c, err := agent.NewSQLCache(ctx, db, table, codec)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Cache[S]{SQLCache: c, db: db}, nil
+}
+
+// Close closes the database.
+func (c *Cache[S]) Close() error {
+	return c.db.Close()
+}
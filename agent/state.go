@@ -2,10 +2,31 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/tbxark/formagent/types"
 )
 
+// ErrStateConflict is matched by errors.Is when a state was changed by another writer
+// since it was loaded.
+var ErrStateConflict = errors.New("state version conflict")
+
+// ConflictError is returned by StateStore.Save when the stored state no longer has the
+// version the saved state was loaded with.
+type ConflictError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("state version conflict: expected version %d, stored version is %d", e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrStateConflict
+}
+
 type StateReadWriter[T any] interface {
 	Load(ctx context.Context) (*State[T], error)
 	Save(ctx context.Context, state *State[T]) error
@@ -27,7 +48,12 @@ func NewStateStore[T any](
 	}
 }
 
-func (s *StateStore[T]) initState(ctx context.Context) *State[T] {
+// StateInitializer is implemented by state stores that know how to build a fresh state.
+type StateInitializer[T any] interface {
+	InitState(ctx context.Context) *State[T]
+}
+
+func (s *StateStore[T]) InitState(ctx context.Context) *State[T] {
 	if s.stateInit != nil {
 		return &State[T]{
 			Phase:     types.PhaseCollecting,
@@ -47,7 +73,13 @@ func (s *StateStore[T]) Load(ctx context.Context) (*State[T], error) {
 		return nil, err
 	}
 	if !ok {
-		st = s.initState(ctx)
+		st = s.InitState(ctx)
+	}
+	if st.Phase == types.PhaseConfirmed {
+		// states saved before the confirming phase existed were confirmed by submitting
+		migrated := *st
+		migrated.Phase = types.PhaseSubmitted
+		st = &migrated
 	}
 	return st, nil
 }
@@ -59,11 +91,32 @@ func (s *StateStore[T]) Save(ctx context.Context, state *State[T]) error {
 	if state.Phase == "" {
 		state.Phase = types.PhaseCollecting
 	}
-	return s.store.Set(ctx, state)
+	// the copy only keeps the caller's Version unchanged until the save succeeds; it is
+	// shallow, so FormState and PatchHistory are still shared with state
+	next := *state
+	next.Version = state.Version + 1
+	var actual int64
+	saved, err := s.store.CompareAndSet(ctx, &next, func(current *State[T], ok bool) bool {
+		if ok && current != nil {
+			actual = current.Version
+		}
+		return actual == state.Version
+	})
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return &ConflictError{Expected: state.Version, Actual: actual}
+	}
+	state.Version = next.Version
+	return nil
 }
 
 func (s *StateStore[T]) Clear(ctx context.Context) error {
 	return s.store.Del(ctx)
 }
 
-var _ StateReadWriter[any] = (*StateStore[any])(nil)
+var (
+	_ StateReadWriter[any]  = (*StateStore[any])(nil)
+	_ StateInitializer[any] = (*StateStore[any])(nil)
+)
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 type KeyGen func(ctx context.Context) (string, bool)
@@ -37,6 +38,23 @@ func (c Store[S]) Set(ctx context.Context, val S) error {
 	return c.core.Set(ctx, key, val)
 }
 
+func (c Store[S]) SetWithTTL(ctx context.Context, val S, ttl time.Duration) error {
+	key, ok := c.key(ctx)
+	if !ok {
+		return errors.New("key not found")
+	}
+	return c.core.SetWithTTL(ctx, key, val, ttl)
+}
+
+// CompareAndSet stores val only if match accepts the current value.
+func (c Store[S]) CompareAndSet(ctx context.Context, val S, match func(current S, ok bool) bool) (bool, error) {
+	key, ok := c.key(ctx)
+	if !ok {
+		return false, errors.New("key not found")
+	}
+	return c.core.CompareAndSet(ctx, key, val, match)
+}
+
 func (c Store[S]) Get(ctx context.Context) (S, bool, error) {
 	key, ok := c.key(ctx)
 	if !ok {
@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tbxark/formagent/types"
+)
+
+// Submitter receives the final form once the user has confirmed it. A FormSpec may
+// implement Submitter directly; FormFlow.Submitter takes precedence when both are set.
+type Submitter[T any] interface {
+	Submit(ctx context.Context, current T) (*Receipt, error)
+}
+
+type SubmitterFunc[T any] func(ctx context.Context, current T) (*Receipt, error)
+
+func (f SubmitterFunc[T]) Submit(ctx context.Context, current T) (*Receipt, error) {
+	return f(ctx, current)
+}
+
+type Receipt struct {
+	ID       string            `json:"id,omitempty"`
+	Message  string            `json:"message,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SubmitError lets a Submitter point the user at the fields that caused a rejected submission.
+type SubmitError struct {
+	Fields []types.FieldInfo
+	Err    error
+}
+
+func (e *SubmitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("submit failed: %v", e.Err)
+	}
+	return "submit failed"
+}
+
+func (e *SubmitError) Unwrap() error {
+	return e.Err
+}
@@ -1,26 +1,52 @@
 package agent
 
 import (
+	"context"
+
 	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/patch"
 	"github.com/tbxark/formagent/types"
 )
 
 type State[T any] struct {
-	Phase     types.Phase `json:"phase" jsonschema:"enum=collecting,enum=confirming,enum=submitted,enum=cancelled,description=The current phase of the form filling process"`
+	Phase     types.Phase `json:"phase" jsonschema:"enum=collecting,enum=confirming,enum=submitted,enum=submit_failed,enum=cancelled,description=The current phase of the form filling process"`
 	FormState T           `json:"form_state" jsonschema:"description=The current state of the form being filled"`
+
+	PatchHistory *patch.History `json:"patch_history,omitempty" jsonschema:"description=Applied patch batches available for undo and redo"`
+	// Version counts the saves of this state. StateStore.Save only succeeds when it still
+	// matches the stored version.
+	Version int64 `json:"version,omitempty" jsonschema:"description=Revision of the state, incremented on every save"`
 }
 type Request[T any] struct {
 	State       *State[T]         `json:"state"`
 	ChatHistory []*schema.Message `json:"chat_history"`
+	// StateInit builds the form after a reset when the flow has no StateInit.
+	StateInit func(ctx context.Context) T `json:"-"`
 }
 type Response[T any] struct {
 	Message  string            `json:"message,omitempty"`
 	State    *State[T]         `json:"state,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+	Report   *TurnReport       `json:"report,omitempty"`
 }
 
 type StreamResponse[T any] struct {
 	MessageStream *schema.StreamReader[string] `json:"-"`
 	State         *State[T]                    `json:"state,omitempty"`
 	Metadata      map[string]string            `json:"metadata,omitempty"`
+	Report        *TurnReport                  `json:"report,omitempty"`
+}
+
+// TurnReport describes what the flow did during a turn.
+type TurnReport struct {
+	Intent           indent.Intent     `json:"intent,omitempty"`
+	PreviousPhase    types.Phase       `json:"previous_phase"`
+	Phase            types.Phase       `json:"phase"`
+	Ops              []patch.Operation `json:"ops,omitempty"`
+	RejectedOps      []patch.Rejection `json:"rejected_ops,omitempty"`
+	MissingFields    []types.FieldInfo `json:"missing_fields,omitempty"`
+	ValidationErrors []types.FieldInfo `json:"validation_errors,omitempty"`
+	// Submitted is set when the turn called the Submitter, whether or not it succeeded.
+	Submitted bool `json:"submitted,omitempty"`
 }
@@ -47,7 +47,28 @@ func (g *LocalDialogueGenerator[T]) GenerateDialogue(ctx context.Context, req *t
 			return "请继续填写表单。", nil
 		}
 		return sb.String(), nil
-	case types.PhaseConfirmed:
+	case types.PhaseConfirming:
+		var sb strings.Builder
+		if req.StateSummary != "" {
+			sb.WriteString(req.StateSummary)
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString("请核对以上信息，确认无误请回复“确认提交”，如需修改请直接告诉我。")
+		return sb.String(), nil
+
+	case types.PhaseSubmitFailed:
+		var sb strings.Builder
+		sb.WriteString("表单提交失败：\n")
+		for _, err := range req.ValidationErrors {
+			if len(err.Description) > 0 {
+				sb.WriteString(err.Description)
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString("请修改后回复“确认”重新提交。")
+		return sb.String(), nil
+
+	case types.PhaseSubmitted:
 		return "表单已成功提交！", nil
 
 	case types.PhaseCancelled:
@@ -38,7 +38,10 @@ You are a form-completion dialogue assistant. Your task is to guide the user to
 - If both missing fields and validation errors exist, prioritize addressing validation errors first.
 - Acknowledge correctly completed fields or progress when appropriate.
 - If the form is complete and valid, explicitly ask whether the user wants to submit it.
+- If the current phase is **confirming**, present a complete summary of every filled field and ask the user for final approval before submission; tell them they can still change any value.
+- If the current phase is **submit_failed**, explain why the submission was rejected using the validation errors, and ask the user to fix the problem or confirm again to retry.
 - If the dialogue history indicates the user changed a value, confirm the update and reflect the latest form status.
+- If the latest user message asks to clear the form or start over and the form state is empty, acknowledge that the form has been cleared and ask for the first missing field.
 
 ## Language Constraint
 - Always reply in **Simplified Chinese**.
@@ -53,6 +56,7 @@ type PromptBuilder[T any] func(systemPrompt string) func(ctx context.Context, re
 type dialogueGeneratorOptions[T any] struct {
 	systemPrompt  string
 	promptBuilder PromptBuilder[T]
+	historyPolicy *types.HistoryPolicy
 }
 
 type GeneratorOption[T any] func(*dialogueGeneratorOptions[T])
@@ -69,21 +73,24 @@ func WithDialoguePromptBuilder[T any](promptBuilder PromptBuilder[T]) GeneratorO
 	}
 }
 
+// WithDialoguePromptRenderer renders the user prompt with renderer instead of the default
+// sections; it replaces any prompt builder set before it.
+func WithDialoguePromptRenderer[T any](renderer *types.PromptRenderer[T]) GeneratorOption[T] {
+	return WithDialoguePromptBuilder[T](renderer.PromptBuilder)
+}
+
+// WithDialogueHistoryPolicy limits the chat history rendered into the prompt, whichever
+// prompt builder is used.
+func WithDialogueHistoryPolicy[T any](policy types.HistoryPolicy) GeneratorOption[T] {
+	return func(o *dialogueGeneratorOptions[T]) {
+		o.historyPolicy = &policy
+	}
+}
+
 func newDialogueGeneratorOptions[T any](opts ...GeneratorOption[T]) dialogueGeneratorOptions[T] {
 	opt := dialogueGeneratorOptions[T]{
-		systemPrompt: DefaultDialogueSystemPrompt,
-		promptBuilder: func(systemPrompt string) func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-			return func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-				message, err := types.FormatToolRequest(req)
-				if err != nil {
-					return nil, fmt.Errorf("convert to prompt message failed: %w", err)
-				}
-				return []*schema.Message{
-					schema.SystemMessage(systemPrompt),
-					schema.UserMessage(message),
-				}, nil
-			}
-		},
+		systemPrompt:  DefaultDialogueSystemPrompt,
+		promptBuilder: types.DefaultPromptRenderer[T]().PromptBuilder,
 	}
 	for _, o := range opts {
 		o(&opt)
@@ -99,7 +106,7 @@ type ToolBasedDialogueGenerator[T any] struct {
 func NewToolBasedDialogueGenerator[T any](chatModel model.ToolCallingChatModel, opts ...GeneratorOption[T]) *ToolBasedDialogueGenerator[T] {
 	options := newDialogueGeneratorOptions[T](opts...)
 	return &ToolBasedDialogueGenerator[T]{
-		promptBuilder: options.promptBuilder(options.systemPrompt),
+		promptBuilder: types.LimitHistory(options.historyPolicy, options.promptBuilder(options.systemPrompt)),
 		chatModel:     chatModel,
 	}
 }
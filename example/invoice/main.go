@@ -14,7 +14,7 @@ import (
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
 	"github.com/tbxark/formagent/agent"
-	"github.com/tbxark/formagent/types"
+	"github.com/tbxark/formagent/patch"
 )
 
 func main() {
@@ -73,11 +73,14 @@ func startApp(ctx context.Context, config *Config) error {
 	if err != nil {
 		return err
 	}
+	flow.PatchValidator = patch.NewSchemaValidatorFor[*Invoice]()
 	formAgent := agent.NewAgent(
 		"InvoiceFiller",
 		"An agent that helps users fill and submit invoice forms via conversation",
 		flow,
 		stateManager,
+		agent.WithHistory[*Invoice](historyManager),
+		agent.WithSessionEndPolicy[*Invoice](agent.SessionEndClear),
 	)
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{
 		Agent: formAgent,
@@ -92,11 +95,7 @@ func startApp(ctx context.Context, config *Config) error {
 			break
 		}
 		input = strings.TrimSpace(input)
-		history, rErr := historyManager.Append(ctx, schema.UserMessage(input))
-		if rErr != nil {
-			return rErr
-		}
-		iter := runner.Run(ctx, history)
+		iter := runner.Run(ctx, []adk.Message{schema.UserMessage(input)})
 		for {
 			event, ok := iter.Next()
 			if !ok {
@@ -109,17 +108,6 @@ func startApp(ctx context.Context, config *Config) error {
 			if mErr != nil {
 				return mErr
 			}
-			if _, apErr := historyManager.Append(ctx, msg); apErr != nil {
-				return apErr
-			}
-			state, mErr := stateManager.Load(ctx)
-			if mErr != nil {
-				return mErr
-			}
-			if state.Phase == types.PhaseConfirmed || state.Phase == types.PhaseCancelled {
-				_ = historyManager.Clear(ctx)
-				_ = stateManager.Clear(ctx)
-			}
 			fmt.Printf("\n助手: %v\n======\n", msg.Content)
 		}
 	}
@@ -0,0 +1,334 @@
+package formagenttest
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// CassetteMode selects whether a CassetteModel records or replays interactions.
+type CassetteMode string
+
+const (
+	// ModeRecord forwards calls to the wrapped model and appends them to the cassette.
+	ModeRecord CassetteMode = "record"
+	// ModeReplay answers calls from the cassette without touching any model.
+	ModeReplay CassetteMode = "replay"
+)
+
+// Interaction is one line of a cassette file.
+type Interaction struct {
+	Key      string            `json:"key"`
+	Tools    []string          `json:"tools,omitempty"`
+	ToolName string            `json:"tool_name,omitempty"`
+	Messages []*schema.Message `json:"messages"`
+	Stream   bool              `json:"stream,omitempty"`
+	Response *schema.Message   `json:"response,omitempty"`
+	Chunks   []*schema.Message `json:"chunks,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+var currentDatePattern = regexp.MustCompile(`(# Current Date:[ \t]*\n)[^\n]*`)
+
+// NormalizeCurrentDate replaces the date line types.FormatToolRequest writes under
+// "# Current Date:" so that prompts from different runs hash the same. Tests that
+// depend on the date should pin it with types.FixedClock instead of relying on this.
+func NormalizeCurrentDate(content string) string {
+	return currentDatePattern.ReplaceAllString(content, "${1} <now>")
+}
+
+type cassetteOptions struct {
+	normalizers []func(string) string
+}
+
+type CassetteOption func(*cassetteOptions)
+
+// WithNormalizer adds a function applied to every message before hashing, for prompts
+// that contain other run-dependent values.
+func WithNormalizer(normalize func(content string) string) CassetteOption {
+	return func(o *cassetteOptions) {
+		o.normalizers = append(o.normalizers, normalize)
+	}
+}
+
+type cassetteState struct {
+	mu       sync.Mutex
+	file     *os.File
+	recorded map[string][]*Interaction
+	used     map[string]int
+}
+
+// CassetteModel records chat model calls to a JSONL file and replays them later. In
+// replay mode every call must match a recorded prompt, otherwise it fails.
+type CassetteModel struct {
+	mode        CassetteMode
+	inner       model.ToolCallingChatModel
+	tools       []*schema.ToolInfo
+	normalizers []func(string) string
+	state       *cassetteState
+}
+
+var _ model.ToolCallingChatModel = (*CassetteModel)(nil)
+
+// NewRecorder truncates path and records every call made through inner to it.
+func NewRecorder(inner model.ToolCallingChatModel, path string, opts ...CassetteOption) (*CassetteModel, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassette: %w", err)
+	}
+	m := newCassetteModel(ModeRecord, opts)
+	m.inner = inner
+	m.state.file = file
+	return m, nil
+}
+
+// NewReplayer loads a cassette written by NewRecorder.
+func NewReplayer(path string, opts ...CassetteOption) (*CassetteModel, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	m := newCassetteModel(ModeReplay, opts)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var it Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &it); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette line %d: %w", line, err)
+		}
+		m.state.recorded[it.Key] = append(m.state.recorded[it.Key], &it)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	return m, nil
+}
+
+func newCassetteModel(mode CassetteMode, opts []CassetteOption) *CassetteModel {
+	o := &cassetteOptions{normalizers: []func(string) string{NormalizeCurrentDate}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &CassetteModel{
+		mode:        mode,
+		normalizers: o.normalizers,
+		state: &cassetteState{
+			recorded: make(map[string][]*Interaction),
+			used:     make(map[string]int),
+		},
+	}
+}
+
+func (m *CassetteModel) Mode() CassetteMode {
+	return m.mode
+}
+
+// Close flushes and closes the cassette file when recording.
+func (m *CassetteModel) Close() error {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	if m.state.file == nil {
+		return nil
+	}
+	err := m.state.file.Close()
+	m.state.file = nil
+	return err
+}
+
+// Unused returns the keys of recorded interactions that were never replayed.
+func (m *CassetteModel) Unused() []string {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	var keys []string
+	for key, its := range m.state.recorded {
+		if m.state.used[key] < len(its) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (m *CassetteModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	next := *m
+	next.tools = tools
+	if m.inner != nil {
+		inner, err := m.inner.WithTools(tools)
+		if err != nil {
+			return nil, err
+		}
+		next.inner = inner
+	}
+	return &next, nil
+}
+
+func (m *CassetteModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	it := m.newInteraction(input, false, opts)
+	if m.mode == ModeReplay {
+		rec, err := m.lookup(it)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Error != "" {
+			return nil, errors.New(rec.Error)
+		}
+		if rec.Response == nil {
+			return schema.ConcatMessages(rec.Chunks)
+		}
+		return rec.Response, nil
+	}
+
+	resp, err := m.inner.Generate(ctx, input, opts...)
+	it.Response = resp
+	if err != nil {
+		it.Error = err.Error()
+	}
+	if werr := m.write(it); werr != nil {
+		return nil, werr
+	}
+	return resp, err
+}
+
+func (m *CassetteModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	it := m.newInteraction(input, true, opts)
+	if m.mode == ModeReplay {
+		rec, err := m.lookup(it)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Error != "" && len(rec.Chunks) == 0 {
+			return nil, errors.New(rec.Error)
+		}
+		chunks := rec.Chunks
+		if rec.Response != nil {
+			chunks = []*schema.Message{rec.Response}
+		}
+		if rec.Error == "" {
+			return schema.StreamReaderFromArray(chunks), nil
+		}
+		sr, sw := schema.Pipe[*schema.Message](len(chunks) + 1)
+		for _, chunk := range chunks {
+			sw.Send(chunk, nil)
+		}
+		sw.Send(nil, errors.New(rec.Error))
+		sw.Close()
+		return sr, nil
+	}
+
+	stream, err := m.inner.Stream(ctx, input, opts...)
+	if err != nil {
+		it.Error = err.Error()
+		if werr := m.write(it); werr != nil {
+			return nil, werr
+		}
+		return nil, err
+	}
+	sr, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer stream.Close()
+		defer sw.Close()
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				it.Error = err.Error()
+				sw.Send(nil, err)
+				break
+			}
+			it.Chunks = append(it.Chunks, chunk)
+			if sw.Send(chunk, nil) {
+				it.Error = "stream closed by reader before completion"
+				break
+			}
+		}
+		if werr := m.write(it); werr != nil {
+			sw.Send(nil, werr)
+		}
+	}()
+	return sr, nil
+}
+
+func (m *CassetteModel) newInteraction(input []*schema.Message, stream bool, opts []model.Option) *Interaction {
+	options := model.GetCommonOptions(&model.Options{Tools: m.tools}, opts...)
+	it := &Interaction{
+		Messages: input,
+		ToolName: requestedTool(options),
+		Stream:   stream,
+	}
+	for _, tool := range options.Tools {
+		it.Tools = append(it.Tools, tool.Name)
+	}
+	it.Key = m.key(it)
+	return it
+}
+
+// key hashes the normalized prompt together with the offered and requested tools.
+// Streaming and non-streaming calls share keys so either can replay the other.
+func (m *CassetteModel) key(it *Interaction) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "tools:%s\ntool:%s\n", strings.Join(it.Tools, ","), it.ToolName)
+	for _, msg := range it.Messages {
+		content := msg.Content
+		for _, normalize := range m.normalizers {
+			content = normalize(content)
+		}
+		fmt.Fprintf(h, "%s:%d:%s\n", msg.Role, len(content), content)
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(h, "call:%s:%s\n", tc.Function.Name, tc.Function.Arguments)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func (m *CassetteModel) lookup(it *Interaction) (*Interaction, error) {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	recorded := m.state.recorded[it.Key]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("formagenttest: cassette has no interaction for key %s (tool %q, last user message %q)", it.Key, it.ToolName, lastUserMessage(it.Messages))
+	}
+	// identical prompts are answered in recording order, then the last answer repeats
+	idx := min(m.state.used[it.Key], len(recorded)-1)
+	m.state.used[it.Key]++
+	return recorded[idx], nil
+}
+
+func (m *CassetteModel) write(it *Interaction) error {
+	line, err := json.Marshal(it)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette interaction: %w", err)
+	}
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	if m.state.file == nil {
+		return errors.New("formagenttest: cassette is closed")
+	}
+	if _, err := m.state.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+func lastUserMessage(messages []*schema.Message) string {
+	return (&Call{Messages: messages}).LastUserMessage()
+}
@@ -0,0 +1,100 @@
+package formagenttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+func promptAt(now, user string) []*schema.Message {
+	return []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("# Current Date: \n " + now + "\n# Latest user message:\n" + user),
+	}
+}
+
+func readAll(t *testing.T, sr *schema.StreamReader[*schema.Message]) string {
+	t.Helper()
+	defer sr.Close()
+	var sb strings.Builder
+	for {
+		msg, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			return sb.String()
+		}
+		if err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		sb.WriteString(msg.Content)
+	}
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	tool := &schema.ToolInfo{Name: "parse_intent"}
+
+	fake := NewFakeChatModel()
+	fake.ChunkSize = 3
+	fake.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	fake.OnText().ReplyText("第一次").ReplyText("第二次")
+
+	rec, err := NewRecorder(fake, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTool, _ := rec.WithTools([]*schema.ToolInfo{tool})
+	if _, err := withTool.Generate(ctx, promptAt("2025-01-01T00:00:00Z", "改标题"), model.WithToolChoice(schema.ToolChoiceForced, "parse_intent")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Generate(ctx, promptAt("2025-01-01T00:00:00Z", "你好")); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := rec.Stream(ctx, promptAt("2025-01-01T00:00:01Z", "你好"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, sr); got != "第二次" {
+		t.Fatalf("recorded stream = %q", got)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTool, _ = replay.WithTools([]*schema.ToolInfo{tool})
+	msg, err := withTool.Generate(ctx, promptAt("2030-06-01T12:00:00+08:00", "改标题"), model.WithToolChoice(schema.ToolChoiceForced, "parse_intent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"intent":"edit"}` {
+		t.Fatalf("unexpected tool call replay: %+v", msg)
+	}
+	msg, err = replay.Generate(ctx, promptAt("2030-06-01T12:00:00+08:00", "你好"))
+	if err != nil || msg.Content != "第一次" {
+		t.Fatalf("first replay = %v, %v", msg, err)
+	}
+	sr, err = replay.Stream(ctx, promptAt("2030-06-01T12:00:00+08:00", "你好"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, sr); got != "第二次" {
+		t.Fatalf("replayed stream = %q", got)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Fatalf("unused interactions: %v", unused)
+	}
+
+	if _, err := replay.Generate(ctx, promptAt("2030-06-01T12:00:00+08:00", "没录过")); err == nil || !strings.Contains(err.Error(), "没录过") {
+		t.Fatalf("expected unmatched error, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+// Package formagenttest provides a scriptable chat model for testing form flows
+// without network access.
+package formagenttest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Call records a single request made to a FakeChatModel.
+type Call struct {
+	Messages []*schema.Message
+	Tools    []*schema.ToolInfo
+	// ToolName is the tool the caller forced or, failing that, the only tool offered.
+	ToolName string
+	Stream   bool
+}
+
+// Prompt returns the contents of all messages joined by newlines.
+func (c *Call) Prompt() string {
+	parts := make([]string, 0, len(c.Messages))
+	for _, m := range c.Messages {
+		parts = append(parts, m.Content)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// LastUserMessage returns the content of the last user message, or "".
+func (c *Call) LastUserMessage() string {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Role == schema.User {
+			return c.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// Reply is a scripted model response.
+type Reply struct {
+	Content string
+	// ToolArguments makes the reply a call to the requested tool with these JSON arguments.
+	ToolArguments string
+	// Chunks overrides how Content is split when the reply is streamed.
+	Chunks []string
+	// Err fails the call. When streaming a reply that also has content, the content is
+	// streamed first and Err ends the stream instead.
+	Err error
+}
+
+// Rule matches calls and answers them with its replies in order. The last reply is
+// repeated once the others have been used.
+type Rule struct {
+	tool     string
+	textOnly bool
+	contains []string
+	userSays []string
+	match    func(*Call) bool
+	replies  []Reply
+	used     int
+}
+
+func (r *Rule) WhenPromptContains(substrings ...string) *Rule {
+	r.contains = append(r.contains, substrings...)
+	return r
+}
+
+// WhenUserSays restricts the rule to calls whose last user message contains all substrings.
+func (r *Rule) WhenUserSays(substrings ...string) *Rule {
+	r.userSays = append(r.userSays, substrings...)
+	return r
+}
+
+func (r *Rule) When(match func(call *Call) bool) *Rule {
+	r.match = match
+	return r
+}
+
+func (r *Rule) Reply(replies ...Reply) *Rule {
+	r.replies = append(r.replies, replies...)
+	return r
+}
+
+func (r *Rule) ReplyText(content string) *Rule {
+	return r.Reply(Reply{Content: content})
+}
+
+func (r *Rule) ReplyStream(chunks ...string) *Rule {
+	return r.Reply(Reply{Content: strings.Join(chunks, ""), Chunks: chunks})
+}
+
+func (r *Rule) ReplyToolCall(arguments string) *Rule {
+	return r.Reply(Reply{ToolArguments: arguments})
+}
+
+func (r *Rule) ReplyError(err error) *Rule {
+	return r.Reply(Reply{Err: err})
+}
+
+func (r *Rule) matches(call *Call) bool {
+	if len(r.replies) == 0 {
+		return false
+	}
+	if r.tool != "" && call.ToolName != r.tool {
+		return false
+	}
+	if r.textOnly && call.ToolName != "" {
+		return false
+	}
+	prompt := call.Prompt()
+	for _, s := range r.contains {
+		if !strings.Contains(prompt, s) {
+			return false
+		}
+	}
+	user := call.LastUserMessage()
+	for _, s := range r.userSays {
+		if !strings.Contains(user, s) {
+			return false
+		}
+	}
+	return r.match == nil || r.match(call)
+}
+
+func (r *Rule) next() Reply {
+	reply := r.replies[min(r.used, len(r.replies)-1)]
+	r.used++
+	return reply
+}
+
+type fakeState struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls []*Call
+}
+
+// FakeChatModel is a deterministic model.ToolCallingChatModel. Rules are checked in the
+// order they were added and the first match answers the call; unmatched calls fail.
+type FakeChatModel struct {
+	state *fakeState
+	tools []*schema.ToolInfo
+	// ChunkSize is the number of runes per chunk when streaming tool arguments or
+	// content without explicit chunks. Zero streams them in a single chunk.
+	ChunkSize int
+}
+
+var _ model.ToolCallingChatModel = (*FakeChatModel)(nil)
+
+func NewFakeChatModel() *FakeChatModel {
+	return &FakeChatModel{state: &fakeState{}}
+}
+
+// OnTool adds a rule for calls that request the named tool.
+func (m *FakeChatModel) OnTool(name string) *Rule {
+	return m.addRule(&Rule{tool: name})
+}
+
+// OnText adds a rule for calls that do not request a tool, such as dialogue generation.
+func (m *FakeChatModel) OnText() *Rule {
+	return m.addRule(&Rule{textOnly: true})
+}
+
+// OnAny adds a rule that matches every call.
+func (m *FakeChatModel) OnAny() *Rule {
+	return m.addRule(&Rule{})
+}
+
+func (m *FakeChatModel) addRule(r *Rule) *Rule {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.rules = append(m.state.rules, r)
+	return r
+}
+
+// Calls returns the calls received so far.
+func (m *FakeChatModel) Calls() []*Call {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	return slices.Clone(m.state.calls)
+}
+
+// CallsFor returns the calls that requested the named tool; "" selects text calls.
+func (m *FakeChatModel) CallsFor(tool string) []*Call {
+	var out []*Call
+	for _, c := range m.Calls() {
+		if c.ToolName == tool {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (m *FakeChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return &FakeChatModel{state: m.state, tools: tools, ChunkSize: m.ChunkSize}, nil
+}
+
+func (m *FakeChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	call, reply, err := m.answer(ctx, input, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	if reply.ToolArguments != "" {
+		return schema.AssistantMessage(reply.Content, []schema.ToolCall{toolCall(call.ToolName, reply.ToolArguments, 0)}), nil
+	}
+	return schema.AssistantMessage(reply.Content, nil), nil
+}
+
+func (m *FakeChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	call, reply, err := m.answer(ctx, input, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Err != nil && reply.Content == "" && reply.ToolArguments == "" && len(reply.Chunks) == 0 {
+		return nil, reply.Err
+	}
+	var chunks []*schema.Message
+	if reply.ToolArguments != "" {
+		for i, part := range splitChunks(reply.ToolArguments, m.ChunkSize) {
+			tc := toolCall(call.ToolName, part, 0)
+			if i > 0 {
+				tc.ID = ""
+				tc.Function.Name = ""
+			}
+			chunks = append(chunks, schema.AssistantMessage("", []schema.ToolCall{tc}))
+		}
+	} else {
+		parts := reply.Chunks
+		if parts == nil {
+			parts = splitChunks(reply.Content, m.ChunkSize)
+		}
+		for _, part := range parts {
+			chunks = append(chunks, schema.AssistantMessage(part, nil))
+		}
+	}
+	if reply.Err == nil {
+		return schema.StreamReaderFromArray(chunks), nil
+	}
+	sr, sw := schema.Pipe[*schema.Message](len(chunks) + 1)
+	for _, chunk := range chunks {
+		sw.Send(chunk, nil)
+	}
+	sw.Send(nil, reply.Err)
+	sw.Close()
+	return sr, nil
+}
+
+func (m *FakeChatModel) answer(ctx context.Context, input []*schema.Message, stream bool, opts []model.Option) (*Call, Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Reply{}, err
+	}
+	options := model.GetCommonOptions(&model.Options{Tools: m.tools}, opts...)
+	call := &Call{
+		Messages: slices.Clone(input),
+		Tools:    options.Tools,
+		ToolName: requestedTool(options),
+		Stream:   stream,
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.calls = append(m.state.calls, call)
+	for _, r := range m.state.rules {
+		if r.matches(call) {
+			return call, r.next(), nil
+		}
+	}
+	return call, Reply{}, fmt.Errorf("formagenttest: no rule matches call (tool %q, last user message %q)", call.ToolName, call.LastUserMessage())
+}
+
+func requestedTool(options *model.Options) string {
+	if options.ToolChoice != nil && *options.ToolChoice == schema.ToolChoiceForbidden {
+		return ""
+	}
+	if len(options.AllowedToolNames) > 0 {
+		return options.AllowedToolNames[0]
+	}
+	if len(options.Tools) == 1 {
+		return options.Tools[0].Name
+	}
+	return ""
+}
+
+func toolCall(name, arguments string, index int) schema.ToolCall {
+	return schema.ToolCall{
+		Index: &index,
+		ID:    "call_" + name,
+		Type:  "function",
+		Function: schema.FunctionCall{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}
+}
+
+func splitChunks(text string, size int) []string {
+	if size <= 0 || len(text) <= size {
+		return []string{text}
+	}
+	var out []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(size, len(runes))
+		out = append(out, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return out
+}
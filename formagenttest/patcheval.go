@@ -0,0 +1,415 @@
+package formagenttest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/patch"
+	"github.com/tbxark/formagent/types"
+)
+
+// PatchCase is one line of a patch evaluation dataset.
+type PatchCase[T any] struct {
+	Name  string      `json:"name"`
+	State T           `json:"state"`
+	Phase types.Phase `json:"phase,omitempty"`
+	// Now pins the current date for cases with relative dates; its offset is used as
+	// the user's time zone.
+	Now         time.Time         `json:"now,omitzero"`
+	Messages    []*schema.Message `json:"messages"`
+	ExpectedOps []patch.Operation `json:"expected_ops"`
+}
+
+// LoadPatchCases reads a JSONL dataset with one PatchCase per line. Cases without a
+// name are named after their line number.
+func LoadPatchCases[T any](path string) ([]*PatchCase[T], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer file.Close()
+
+	var cases []*PatchCase[T]
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		var c PatchCase[T]
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: failed to parse case: %w", path, line, err)
+		}
+		if c.Name == "" {
+			c.Name = "line " + strconv.Itoa(line)
+		}
+		cases = append(cases, &c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	return cases, nil
+}
+
+// PatchCaseResult scores a generator on one case. Fields are the leaf JSON pointers of
+// the form whose value changed; a predicted field is correct when it ends up with the
+// expected value.
+type PatchCaseResult struct {
+	Name      string            `json:"name"`
+	Ops       []patch.Operation `json:"ops,omitempty"`
+	Invalid   []patch.Rejection `json:"invalid,omitempty"`
+	Expected  int               `json:"expected"`
+	Predicted int               `json:"predicted"`
+	Correct   int               `json:"correct"`
+	Exact     bool              `json:"exact"`
+	Latency   time.Duration     `json:"latency"`
+	Err       string            `json:"error,omitempty"`
+}
+
+// PatchEvalResult aggregates the case results of one generator.
+type PatchEvalResult struct {
+	Name  string             `json:"name"`
+	Cases []*PatchCaseResult `json:"cases"`
+}
+
+// Precision is the micro-averaged share of predicted field changes that are correct,
+// or 1 when nothing was predicted.
+func (r *PatchEvalResult) Precision() float64 {
+	var correct, predicted int
+	for _, c := range r.Cases {
+		correct += c.Correct
+		predicted += c.Predicted
+	}
+	return ratio(correct, predicted)
+}
+
+// Recall is the micro-averaged share of expected field changes that were produced, or
+// 1 when nothing was expected.
+func (r *PatchEvalResult) Recall() float64 {
+	var correct, expected int
+	for _, c := range r.Cases {
+		correct += c.Correct
+		expected += c.Expected
+	}
+	return ratio(correct, expected)
+}
+
+// ExactMatchRate is the share of cases whose resulting form equals the expected one.
+func (r *PatchEvalResult) ExactMatchRate() float64 {
+	exact := 0
+	for _, c := range r.Cases {
+		if c.Exact {
+			exact++
+		}
+	}
+	return ratio(exact, len(r.Cases))
+}
+
+// InvalidOpRate is the share of generated operations that were rejected by the
+// validator or could not be applied.
+func (r *PatchEvalResult) InvalidOpRate() float64 {
+	var invalid, total int
+	for _, c := range r.Cases {
+		invalid += len(c.Invalid)
+		total += len(c.Ops)
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(invalid) / float64(total)
+}
+
+// ErrorRate is the share of cases where the generator returned an error.
+func (r *PatchEvalResult) ErrorRate() float64 {
+	failed := 0
+	for _, c := range r.Cases {
+		if c.Err != "" {
+			failed++
+		}
+	}
+	if len(r.Cases) == 0 {
+		return 0
+	}
+	return float64(failed) / float64(len(r.Cases))
+}
+
+func (r *PatchEvalResult) MeanLatency() time.Duration {
+	if len(r.Cases) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, c := range r.Cases {
+		total += c.Latency
+	}
+	return total / time.Duration(len(r.Cases))
+}
+
+// LatencyPercentile returns the latency below which p percent of the cases finished.
+func (r *PatchEvalResult) LatencyPercentile(p float64) time.Duration {
+	if len(r.Cases) == 0 {
+		return 0
+	}
+	latencies := make([]time.Duration, 0, len(r.Cases))
+	for _, c := range r.Cases {
+		latencies = append(latencies, c.Latency)
+	}
+	slices.Sort(latencies)
+	// nearest rank, so the slowest case counts for any p above (n-1)/n
+	idx := int(math.Ceil(float64(len(latencies))*p/100)) - 1
+	return latencies[min(max(idx, 0), len(latencies)-1)]
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 1
+	}
+	return float64(n) / float64(d)
+}
+
+// PatchEvaluator runs patch generators over a dataset. Spec and Validator are optional;
+// without a Spec the state summary is the form's JSON.
+type PatchEvaluator[T any] struct {
+	Spec      agent.FormSpec[T]
+	Validator patch.Validator
+}
+
+// Evaluate runs gen on every case sequentially so latencies are comparable.
+func (e *PatchEvaluator[T]) Evaluate(ctx context.Context, name string, gen patch.Generator[T], cases []*PatchCase[T]) *PatchEvalResult {
+	result := &PatchEvalResult{Name: name}
+	for _, c := range cases {
+		result.Cases = append(result.Cases, e.evaluateCase(ctx, gen, c))
+	}
+	return result
+}
+
+func (e *PatchEvaluator[T]) evaluateCase(ctx context.Context, gen patch.Generator[T], c *PatchCase[T]) *PatchCaseResult {
+	res := &PatchCaseResult{Name: c.Name}
+	base, err := flattenJSON(c.State)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	expectedState, _ := applyEach(c.State, c.ExpectedOps)
+	expected, err := flattenJSON(expectedState)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	res.Expected = len(changedFields(base, expected))
+
+	start := time.Now()
+	args, err := gen.GeneratePatch(ctx, e.toolRequest(ctx, c))
+	res.Latency = time.Since(start)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	if args == nil {
+		args = &patch.UpdateFormArgs{}
+	}
+	res.Ops = args.Ops
+
+	ops := args.Ops
+	if e.Validator != nil {
+		var rejected []patch.Rejection
+		ops, rejected = e.Validator.Validate(ops)
+		res.Invalid = append(res.Invalid, rejected...)
+	}
+	actualState, failed := applyEach(c.State, ops)
+	res.Invalid = append(res.Invalid, failed...)
+	actual, err := flattenJSON(actualState)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+
+	predicted := changedFields(base, actual)
+	res.Predicted = len(predicted)
+	for _, field := range predicted {
+		// a removed field is correct when the expected form lacks it too
+		want, wantOK := expected[field]
+		got, gotOK := actual[field]
+		if wantOK == gotOK && want == got {
+			res.Correct++
+		}
+	}
+	res.Exact = maps.Equal(expected, actual)
+	return res
+}
+
+func (e *PatchEvaluator[T]) toolRequest(ctx context.Context, c *PatchCase[T]) *types.ToolRequest[T] {
+	phase := c.Phase
+	if phase == "" {
+		phase = types.PhaseCollecting
+	}
+	req := &types.ToolRequest[T]{
+		State:    c.State,
+		Phase:    phase,
+		Messages: c.Messages,
+		Extra:    make(map[string]any),
+	}
+	if !c.Now.IsZero() {
+		req.Clock = types.FixedClock(c.Now)
+	}
+	if e.Spec != nil {
+		req.StateSummary = e.Spec.Summary(ctx, c.State)
+		req.MissingFields = e.Spec.MissingFacts(ctx, c.State)
+		req.ValidationErrors = e.Spec.ValidateFacts(ctx, c.State)
+	} else if b, err := json.Marshal(c.State); err == nil {
+		req.StateSummary = types.WrapMarkdownCodeBlock(string(b), "json")
+	}
+	return req
+}
+
+// applyEach applies operations one at a time so a single bad operation does not
+// discard the rest, and reports the ones that failed.
+func applyEach[T any](current T, ops []patch.Operation) (T, []patch.Rejection) {
+	var failed []patch.Rejection
+	for _, op := range ops {
+		next, err := patch.ApplyRFC6902(current, []patch.Operation{op})
+		if err != nil {
+			failed = append(failed, patch.Rejection{Operation: op, Reason: err.Error()})
+			continue
+		}
+		current = next
+	}
+	return current, failed
+}
+
+// flattenJSON maps the JSON pointer of every leaf value, including empty objects and
+// arrays, to its compact JSON encoding.
+func flattenJSON(v any) (map[string]string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal form state: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode form state: %w", err)
+	}
+	out := make(map[string]string)
+	flatten("", doc, out)
+	return out, nil
+}
+
+func flatten(pointer string, v any, out map[string]string) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 {
+			out[pointer] = "{}"
+		}
+		for key, child := range val {
+			flatten(pointer+"/"+strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1"), child, out)
+		}
+	case []any:
+		if len(val) == 0 {
+			out[pointer] = "[]"
+		}
+		for i, child := range val {
+			flatten(pointer+"/"+strconv.Itoa(i), child, out)
+		}
+	default:
+		out[pointer] = compactJSON(val)
+	}
+}
+
+func changedFields(before, after map[string]string) []string {
+	var fields []string
+	for field, value := range after {
+		if old, ok := before[field]; !ok || old != value {
+			fields = append(fields, field)
+		}
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// ComparePatchEvals renders a markdown table with one column per result. With two
+// results a delta column and the cases whose exact match changed are added.
+func ComparePatchEvals(results ...*PatchEvalResult) string {
+	type metric struct {
+		name    string
+		value   func(r *PatchEvalResult) float64
+		percent bool
+	}
+	metrics := []metric{
+		{"precision", (*PatchEvalResult).Precision, true},
+		{"recall", (*PatchEvalResult).Recall, true},
+		{"exact match", (*PatchEvalResult).ExactMatchRate, true},
+		{"invalid ops", (*PatchEvalResult).InvalidOpRate, true},
+		{"errors", (*PatchEvalResult).ErrorRate, true},
+		{"mean latency (ms)", func(r *PatchEvalResult) float64 { return float64(r.MeanLatency().Microseconds()) / 1000 }, false},
+		{"p95 latency (ms)", func(r *PatchEvalResult) float64 { return float64(r.LatencyPercentile(95).Microseconds()) / 1000 }, false},
+	}
+	format := func(v float64, percent bool) string {
+		if percent {
+			return fmt.Sprintf("%.1f%%", v*100)
+		}
+		return fmt.Sprintf("%.1f", v)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("| metric |")
+	for _, r := range results {
+		fmt.Fprintf(&sb, " %s |", r.Name)
+	}
+	delta := len(results) == 2
+	if delta {
+		sb.WriteString(" Δ |")
+	}
+	sb.WriteString("\n|---|")
+	sb.WriteString(strings.Repeat("---|", len(results)))
+	if delta {
+		sb.WriteString("---|")
+	}
+	sb.WriteString("\n")
+	for _, m := range metrics {
+		fmt.Fprintf(&sb, "| %s |", m.name)
+		for _, r := range results {
+			fmt.Fprintf(&sb, " %s |", format(m.value(r), m.percent))
+		}
+		if delta {
+			d := m.value(results[1]) - m.value(results[0])
+			sign := ""
+			if d >= 0 {
+				sign = "+"
+			}
+			fmt.Fprintf(&sb, " %s%s |", sign, format(d, m.percent))
+		}
+		sb.WriteString("\n")
+	}
+
+	if delta {
+		exact := make(map[string]bool, len(results[0].Cases))
+		for _, c := range results[0].Cases {
+			exact[c.Name] = c.Exact
+		}
+		for _, c := range results[1].Cases {
+			if was, ok := exact[c.Name]; ok && was != c.Exact {
+				state := "fixed"
+				if was {
+					state = "regressed"
+				}
+				fmt.Fprintf(&sb, "\n- %s: %s", c.Name, state)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package formagenttest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tbxark/formagent/patch"
+	"github.com/tbxark/formagent/types"
+)
+
+type invoice struct {
+	Title  string  `json:"title,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+	Note   string  `json:"note,omitempty"`
+}
+
+type generatorFunc func(req *types.ToolRequest[*invoice]) (*patch.UpdateFormArgs, error)
+
+func (f generatorFunc) GeneratePatch(ctx context.Context, req *types.ToolRequest[*invoice]) (*patch.UpdateFormArgs, error) {
+	return f(req)
+}
+
+func TestPatchEvaluator(t *testing.T) {
+	dataset := `{"name": "set title and amount", "state": {"note": "x"}, "messages": [{"role": "user", "content": "抬头 A，金额 10"}], "expected_ops": [{"op": "add", "path": "/title", "value": "A"}, {"op": "add", "path": "/amount", "value": 10}]}
+{"name": "clear note", "state": {"title": "A", "note": "x"}, "messages": [{"role": "user", "content": "删掉备注"}], "expected_ops": [{"op": "remove", "path": "/note"}]}
+`
+	path := filepath.Join(t.TempDir(), "cases.jsonl")
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadPatchCases[*invoice](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perfect := generatorFunc(func(req *types.ToolRequest[*invoice]) (*patch.UpdateFormArgs, error) {
+		for _, c := range cases {
+			if c.Messages[0].Content == req.Messages[0].Content {
+				return &patch.UpdateFormArgs{Ops: c.ExpectedOps}, nil
+			}
+		}
+		return nil, errors.New("unknown case")
+	})
+	sloppy := generatorFunc(func(req *types.ToolRequest[*invoice]) (*patch.UpdateFormArgs, error) {
+		if strings.Contains(req.Messages[0].Content, "备注") {
+			return nil, errors.New("timeout")
+		}
+		return &patch.UpdateFormArgs{Ops: []patch.Operation{
+			{Op: "replace", Path: "/title", Value: "A"},
+			{Op: "add", Path: "/amount", Value: "ten"},
+			{Op: "add", Path: "/note", Value: "y"},
+		}}, nil
+	})
+
+	evaluator := &PatchEvaluator[*invoice]{Validator: patch.NewSchemaValidatorFor[invoice]()}
+	ctx := context.Background()
+	base := evaluator.Evaluate(ctx, "baseline", perfect, cases)
+	if base.Precision() != 1 || base.Recall() != 1 || base.ExactMatchRate() != 1 || base.InvalidOpRate() != 0 {
+		t.Fatalf("perfect generator scored %+v", base.Cases)
+	}
+
+	candidate := evaluator.Evaluate(ctx, "candidate", sloppy, cases)
+	first := candidate.Cases[0]
+	if first.Expected != 2 || first.Predicted != 2 || first.Correct != 1 || len(first.Invalid) != 1 || first.Exact {
+		t.Fatalf("unexpected case result: %+v", first)
+	}
+	if candidate.Precision() != 0.5 || candidate.Recall() != 1.0/3 || candidate.ErrorRate() != 0.5 {
+		t.Fatalf("precision %v recall %v errors %v", candidate.Precision(), candidate.Recall(), candidate.ErrorRate())
+	}
+
+	table := ComparePatchEvals(base, candidate)
+	for _, want := range []string{"| metric | baseline | candidate | Δ |", "| precision | 100.0% | 50.0% | -50.0% |", "- set title and amount: regressed"} {
+		if !strings.Contains(table, want) {
+			t.Fatalf("table missing %q:\n%s", want, table)
+		}
+	}
+}
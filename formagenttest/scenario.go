@@ -0,0 +1,333 @@
+package formagenttest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/indent"
+	"github.com/tbxark/formagent/types"
+)
+
+// Turn is one line of a scenario script. Expectations left empty are not checked.
+type Turn struct {
+	User string `json:"user"`
+	// InitialState seeds the form before the first turn; it is only read from the first line.
+	InitialState json.RawMessage `json:"initial_state,omitempty"`
+	ExpectIntent indent.Intent   `json:"expect_intent,omitempty"`
+	ExpectPhase  types.Phase     `json:"expect_phase,omitempty"`
+	// ExpectState is matched partially: only the members it lists are compared.
+	ExpectState json.RawMessage `json:"expect_state,omitempty"`
+}
+
+// Scenario is a scripted conversation loaded from a JSONL file.
+type Scenario struct {
+	Name  string
+	Turns []Turn
+}
+
+// LoadScenario reads a JSONL script with one Turn per line. Blank lines and lines
+// starting with "//" are ignored.
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scenario: %w", err)
+	}
+	defer file.Close()
+
+	sc := &Scenario{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		var turn Turn
+		if err := json.Unmarshal([]byte(text), &turn); err != nil {
+			return nil, fmt.Errorf("%s:%d: failed to parse turn: %w", path, line, err)
+		}
+		sc.Turns = append(sc.Turns, turn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	return sc, nil
+}
+
+// LoadScenarios loads every *.jsonl file in dir, sorted by name.
+func LoadScenarios(dir string) ([]*Scenario, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	scenarios := make([]*Scenario, 0, len(paths))
+	for _, path := range paths {
+		sc, err := LoadScenario(path)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, sc)
+	}
+	return scenarios, nil
+}
+
+// TurnResult is the outcome of one scripted turn.
+type TurnResult struct {
+	Index  int             `json:"index"`
+	User   string          `json:"user"`
+	Reply  string          `json:"reply,omitempty"`
+	Intent indent.Intent   `json:"intent,omitempty"`
+	Phase  types.Phase     `json:"phase,omitempty"`
+	State  json.RawMessage `json:"state,omitempty"`
+	Diffs  []string        `json:"diffs,omitempty"`
+	Err    string          `json:"error,omitempty"`
+}
+
+func (r *TurnResult) Passed() bool {
+	return r.Err == "" && len(r.Diffs) == 0
+}
+
+// ScenarioResult holds the turns that were run; a scenario stops at the first turn
+// that returns an error.
+type ScenarioResult struct {
+	Name  string        `json:"name"`
+	Turns []*TurnResult `json:"turns"`
+}
+
+func (r *ScenarioResult) Passed() bool {
+	for _, t := range r.Turns {
+		if !t.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Report collects the results of a scenario run.
+type Report struct {
+	Scenarios []*ScenarioResult `json:"scenarios"`
+}
+
+func (r *Report) Passed() bool {
+	for _, s := range r.Scenarios {
+		if !s.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders a pass/fail line per scenario followed by the diffs of failed turns.
+func (r *Report) String() string {
+	var sb strings.Builder
+	passed := 0
+	for _, s := range r.Scenarios {
+		if s.Passed() {
+			passed++
+			fmt.Fprintf(&sb, "PASS %s (%d turns)\n", s.Name, len(s.Turns))
+			continue
+		}
+		fmt.Fprintf(&sb, "FAIL %s\n", s.Name)
+		for _, t := range s.Turns {
+			if t.Passed() {
+				continue
+			}
+			fmt.Fprintf(&sb, "  turn %d: %q\n", t.Index+1, t.User)
+			if t.Err != "" {
+				fmt.Fprintf(&sb, "    error: %s\n", t.Err)
+			}
+			for _, d := range t.Diffs {
+				fmt.Fprintf(&sb, "    %s\n", d)
+			}
+		}
+	}
+	fmt.Fprintf(&sb, "%d/%d scenarios passed\n", passed, len(r.Scenarios))
+	return sb.String()
+}
+
+// RunScenarios runs each scenario against flow.
+func RunScenarios[T any](ctx context.Context, flow *agent.FormFlow[T], scenarios []*Scenario) *Report {
+	report := &Report{}
+	for _, sc := range scenarios {
+		report.Scenarios = append(report.Scenarios, RunScenario(ctx, flow, sc))
+	}
+	return report
+}
+
+// RunScenario plays the scenario's user turns through a copy of flow, keeping the chat
+// history and form state between turns, and compares each response to the script.
+func RunScenario[T any](ctx context.Context, flow *agent.FormFlow[T], sc *Scenario) *ScenarioResult {
+	result := &ScenarioResult{Name: sc.Name}
+	recorder := &intentRecorder[T]{inner: flow.IndentRecognizer}
+	f := *flow
+	f.IndentRecognizer = recorder
+
+	state, err := initialState(ctx, flow, sc)
+	if err != nil {
+		result.Turns = append(result.Turns, &TurnResult{Err: err.Error()})
+		return result
+	}
+	var history []*schema.Message
+	for i, turn := range sc.Turns {
+		tr := &TurnResult{Index: i, User: turn.User}
+		result.Turns = append(result.Turns, tr)
+
+		history = append(history, schema.UserMessage(turn.User))
+		recorder.reset()
+		resp, err := f.Invoke(ctx, &agent.Request[T]{State: state, ChatHistory: history})
+		tr.Intent = recorder.last()
+		if err != nil {
+			tr.Err = err.Error()
+			return result
+		}
+		history = append(history, schema.AssistantMessage(resp.Message, nil))
+		state = resp.State
+		tr.Reply = resp.Message
+		tr.Phase = state.Phase
+		if tr.State, err = json.Marshal(state.FormState); err != nil {
+			tr.Err = fmt.Sprintf("failed to marshal form state: %v", err)
+			return result
+		}
+
+		if turn.ExpectIntent != "" && turn.ExpectIntent != tr.Intent {
+			tr.Diffs = append(tr.Diffs, fmt.Sprintf("intent: expected %s, got %s", turn.ExpectIntent, describeIntent(tr.Intent)))
+		}
+		if turn.ExpectPhase != "" && turn.ExpectPhase != tr.Phase {
+			tr.Diffs = append(tr.Diffs, fmt.Sprintf("phase: expected %s, got %s", turn.ExpectPhase, tr.Phase))
+		}
+		if len(turn.ExpectState) > 0 {
+			diffs, err := MatchPartialJSON(turn.ExpectState, tr.State)
+			if err != nil {
+				tr.Err = err.Error()
+				return result
+			}
+			tr.Diffs = append(tr.Diffs, diffs...)
+		}
+	}
+	return result
+}
+
+func initialState[T any](ctx context.Context, flow *agent.FormFlow[T], sc *Scenario) (*agent.State[T], error) {
+	state := &agent.State[T]{Phase: types.PhaseCollecting}
+	if len(sc.Turns) > 0 && len(sc.Turns[0].InitialState) > 0 {
+		if err := json.Unmarshal(sc.Turns[0].InitialState, &state.FormState); err != nil {
+			return nil, fmt.Errorf("failed to decode initial state: %w", err)
+		}
+		return state, nil
+	}
+	if flow.StateInit != nil {
+		state.FormState = flow.StateInit(ctx)
+		return state, nil
+	}
+	// allocate pointer forms so the flow never sees a nil state
+	_ = json.Unmarshal([]byte("{}"), &state.FormState)
+	return state, nil
+}
+
+func describeIntent(intent indent.Intent) string {
+	if intent == "" {
+		return "(not recognized)"
+	}
+	return string(intent)
+}
+
+// MatchPartialJSON reports the members of expected that are missing from or differ in
+// actual. Objects are compared by the keys listed in expected, arrays element by
+// element with the same length, and scalars by value.
+func MatchPartialJSON(expected, actual json.RawMessage) ([]string, error) {
+	var want, got any
+	if err := json.Unmarshal(expected, &want); err != nil {
+		return nil, fmt.Errorf("failed to parse expected state: %w", err)
+	}
+	if err := json.Unmarshal(actual, &got); err != nil {
+		return nil, fmt.Errorf("failed to parse actual state: %w", err)
+	}
+	var diffs []string
+	matchPartial("", want, got, &diffs)
+	return diffs, nil
+}
+
+func matchPartial(path string, want, got any, diffs *[]string) {
+	label := path
+	if label == "" {
+		label = "/"
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected object, got %s", label, compactJSON(got)))
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(w)) {
+			child := path + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+			value, present := g[key]
+			if !present {
+				*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got nothing", child, compactJSON(w[key])))
+				continue
+			}
+			matchPartial(child, w[key], value, diffs)
+		}
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", label, compactJSON(want), compactJSON(got)))
+			return
+		}
+		for i := range w {
+			matchPartial(path+"/"+strconv.Itoa(i), w[i], g[i], diffs)
+		}
+	default:
+		if compactJSON(want) != compactJSON(got) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", label, compactJSON(want), compactJSON(got)))
+		}
+	}
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// intentRecorder remembers the intent recognized during the current turn.
+type intentRecorder[T any] struct {
+	inner  indent.Recognizer[T]
+	mu     sync.Mutex
+	intent indent.Intent
+}
+
+func (r *intentRecorder[T]) RecognizerIntent(ctx context.Context, req *types.ToolRequest[T]) (indent.Intent, error) {
+	intent, err := r.inner.RecognizerIntent(ctx, req)
+	if err == nil {
+		r.mu.Lock()
+		r.intent = intent
+		r.mu.Unlock()
+	}
+	return intent, err
+}
+
+func (r *intentRecorder[T]) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.intent = ""
+}
+
+func (r *intentRecorder[T]) last() indent.Intent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.intent
+}
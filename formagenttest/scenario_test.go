@@ -0,0 +1,88 @@
+package formagenttest_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/types"
+)
+
+type note struct {
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type noteSpec struct{}
+
+func (noteSpec) Summary(ctx context.Context, current *note) string { return current.Title }
+func (noteSpec) MissingFacts(ctx context.Context, current *note) []types.FieldInfo {
+	return nil
+}
+func (noteSpec) ValidateFacts(ctx context.Context, current *note) []types.FieldInfo {
+	return nil
+}
+
+func TestRunScenario(t *testing.T) {
+	script := `{"user": "标题叫周报", "initial_state": {"tags": ["work"]}, "expect_intent": "edit", "expect_state": {"title": "周报", "tags": ["work"]}}
+// the second turn is expected to fail
+{"user": "提交", "expect_intent": "cancel", "expect_phase": "submitted", "expect_state": {"title": "月报"}}
+`
+	path := filepath.Join(t.TempDir(), "weekly.jsonl")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := formagenttest.LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").WhenUserSays("提交").ReplyToolCall(`{"intent":"confirm"}`)
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"周报"}]}`)
+	m.OnText().ReplyText("好的")
+	flow, err := agent.NewToolBasedFormFlow[*note](noteSpec{}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := formagenttest.RunScenarios(context.Background(), flow, []*formagenttest.Scenario{sc})
+	result := report.Scenarios[0]
+	if result.Name != "weekly" || len(result.Turns) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if !result.Turns[0].Passed() {
+		t.Fatalf("first turn should pass: %+v", result.Turns[0])
+	}
+	want := []string{
+		"intent: expected cancel, got confirm",
+		"phase: expected submitted, got confirming",
+		`/title: expected "月报", got "周报"`,
+	}
+	if got := strings.Join(result.Turns[1].Diffs, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("diffs = \n%s", got)
+	}
+	if report.Passed() || !strings.Contains(report.String(), "FAIL weekly") {
+		t.Fatalf("report should fail:\n%s", report)
+	}
+}
+
+func TestMatchPartialJSON(t *testing.T) {
+	diffs, err := formagenttest.MatchPartialJSON(
+		json.RawMessage(`{"a": 1, "b": {"c": [1, 2]}, "d": "x"}`),
+		json.RawMessage(`{"a": 1.0, "b": {"c": [1, 3], "e": true}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "/b/c/1: expected 2, got 3\n/d: expected \"x\", got nothing"
+	if got := strings.Join(diffs, "\n"); got != want {
+		t.Fatalf("diffs = %q", got)
+	}
+}
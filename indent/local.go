@@ -10,12 +10,20 @@ import (
 type LocalIntentRecognizer[T any] struct {
 	CancelKeywords  []string
 	ConfirmKeywords []string
+	UndoKeywords    []string
+	RedoKeywords    []string
+	ResetKeywords   []string
 }
 
 func NewLocalIntentRecognizer[T any]() *LocalIntentRecognizer[T] {
 	return &LocalIntentRecognizer[T]{
-		CancelKeywords:  []string{"取消", "cancel", "退出", "quit", "exit", "停止", "stop"},
-		ConfirmKeywords: []string{"确认", "confirm", "提交", "submit", "完成", "done", "好的", "ok", "好"},
+		CancelKeywords: []string{"取消", "cancel", "退出", "quit", "exit", "停止", "stop"},
+		// short acknowledgements like "好" or "ok" are not confirmations; submitting needs
+		// an explicit keyword
+		ConfirmKeywords: []string{"确认", "confirm", "提交", "submit", "确认提交"},
+		UndoKeywords:    []string{"撤销", "撤回", "undo", "回退"},
+		RedoKeywords:    []string{"重做", "redo"},
+		ResetKeywords:   []string{"重置", "重新开始", "清空", "reset", "restart", "start over"},
 	}
 }
 
@@ -34,6 +42,21 @@ func (p *LocalIntentRecognizer[T]) RecognizerIntent(ctx context.Context, req *ty
 			return Confirm, nil
 		}
 	}
+	for _, keyword := range p.UndoKeywords {
+		if normalized == keyword {
+			return Undo, nil
+		}
+	}
+	for _, keyword := range p.RedoKeywords {
+		if normalized == keyword {
+			return Redo, nil
+		}
+	}
+	for _, keyword := range p.ResetKeywords {
+		if normalized == keyword {
+			return Reset, nil
+		}
+	}
 	return DoNothing, nil
 }
 
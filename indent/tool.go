@@ -13,7 +13,7 @@ import (
 
 const (
 	parseIntentToolName        = "parse_intent"
-	parseIntentToolDescription = "Analyze user input and determine command intent: cancel, confirm, none."
+	parseIntentToolDescription = "Analyze user input and determine command intent: cancel, confirm, edit, undo, redo, reset, do_nothing."
 )
 
 // DefaultParseIntentSystemPromptTemplate is the default system prompt template used by
@@ -27,8 +27,11 @@ IMPORTANT: Always combine the assistant's question/prompt with the user's answer
 
 Choose the most appropriate intent from the allowed ones:
 - cancel: Only return this if the user explicitly expresses intent to abandon or cancel the current form filling process (e.g., "cancel", "quit", "abandon", "stop filling"). Do not interpret general negations like "no", "don't", "not" as cancel unless they clearly refer to abandoning the process in context.
-- confirm: Only return this if the user explicitly expresses intent to confirm and submit the current form (e.g., "confirm", "submit", "yes, proceed", "finalize"). Do not interpret general affirmations like "yes", "ok", "good" as confirm unless they clearly refer to submitting the form in context.
-- edit: Return this if the user's input provides information that would change or update form data, such as filling fields, modifying values, or continuing to provide details for the form.
+- confirm: Only return this if the user explicitly expresses intent to confirm and submit the current form (e.g., "confirm", "submit", "yes, proceed", "finalize"). Do not interpret general affirmations like "yes", "ok", "good" as confirm unless they clearly refer to submitting the form in context. When the current phase is confirming, the assistant has just shown the final summary, so only return confirm if the user explicitly approves submitting it (e.g., "确认", "提交", "confirm", "submit"); a bare acknowledgement such as "好", "好的", "ok" or "嗯" is do_nothing.
+- edit: Return this if the user's input provides information that would change or update form data, such as filling fields, modifying values, or continuing to provide details for the form. In the confirming phase, any requested change to the summary is edit.
+- undo: Return this if the user asks to revert the most recent change to the form (e.g., "undo", "撤回刚才那个", "不对，改回去"). Only use it when the user wants the previous values back without supplying new ones; if they provide the correct value, return edit instead.
+- redo: Return this if the user asks to re-apply a change they just undid (e.g., "redo", "还是改回来吧").
+- reset: Return this if the user wants to clear everything entered so far and start the form over without leaving the conversation (e.g., "start over", "重新开始", "全部清空重来"). Do not use it for changing a single field.
 - do_nothing: Return this for purely conversational input, irrelevant chatter, or responses that do not relate to form editing or the current process.
 
 Call the '%s' tool with the result.
@@ -39,6 +42,9 @@ type PromptBuilder[T any] func(systemPrompt string) func(ctx context.Context, re
 type intentParserOptions[T any] struct {
 	systemPromptTemplate string
 	promptBuilder        PromptBuilder[T]
+	historyPolicy        *types.HistoryPolicy
+	maxAttempts          int
+	strategy             structured.Strategy
 }
 
 type ParserOption[T any] func(*intentParserOptions[T])
@@ -55,21 +61,40 @@ func WithIntentPromptBuilder[T any](promptBuilder PromptBuilder[T]) ParserOption
 	}
 }
 
+// WithIntentPromptRenderer renders the user prompt with renderer instead of the default
+// sections; it replaces any prompt builder set before it.
+func WithIntentPromptRenderer[T any](renderer *types.PromptRenderer[T]) ParserOption[T] {
+	return WithIntentPromptBuilder[T](renderer.PromptBuilder)
+}
+
+// WithIntentHistoryPolicy limits the chat history rendered into the prompt, whichever
+// prompt builder is used.
+func WithIntentHistoryPolicy[T any](policy types.HistoryPolicy) ParserOption[T] {
+	return func(o *intentParserOptions[T]) {
+		o.historyPolicy = &policy
+	}
+}
+
+// WithIntentStrategy selects how structured output is obtained from the model. Use
+// structured.StrategyJSONPrompt for models without tool calling support.
+func WithIntentStrategy[T any](strategy structured.Strategy) ParserOption[T] {
+	return func(o *intentParserOptions[T]) {
+		o.strategy = strategy
+	}
+}
+
+// WithIntentMaxAttempts lets the recognizer re-ask the model, with the parse error
+// attached, when it returns an unusable tool call.
+func WithIntentMaxAttempts[T any](maxAttempts int) ParserOption[T] {
+	return func(o *intentParserOptions[T]) {
+		o.maxAttempts = maxAttempts
+	}
+}
+
 func newIntentRecognizerOptions[T any](opts ...ParserOption[T]) *intentParserOptions[T] {
 	opt := intentParserOptions[T]{
 		systemPromptTemplate: DefaultParseIntentSystemPromptTemplate,
-		promptBuilder: func(systemPrompt string) func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-			return func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-				message, err := types.FormatToolRequest(req)
-				if err != nil {
-					return nil, fmt.Errorf("convert to prompt message failed: %w", err)
-				}
-				return []*schema.Message{
-					schema.SystemMessage(systemPrompt),
-					schema.UserMessage(message),
-				}, nil
-			}
-		},
+		promptBuilder:        types.DefaultPromptRenderer[T]().PromptBuilder,
 	}
 	for _, o := range opts {
 		o(&opt)
@@ -78,24 +103,37 @@ func newIntentRecognizerOptions[T any](opts ...ParserOption[T]) *intentParserOpt
 }
 
 type parseCommandInput struct {
-	Intent Intent `json:"intent" jsonschema:"required,enum=cancel,enum=confirm,enum=edit,enum=do_nothing,description=The user's command intent"`
+	Intent Intent `json:"intent" jsonschema:"required,enum=cancel,enum=confirm,enum=edit,enum=undo,enum=redo,enum=reset,enum=do_nothing,description=The user's command intent"`
 }
 
 type ToolBasedIntentRecognizer[T any] struct {
 	Chain *structured.Chain[*types.ToolRequest[T], parseCommandInput]
 }
 
-func NewToolBasedIntentRecognizer[T any](chatModel model.ToolCallingChatModel, opts ...ParserOption[T]) (*ToolBasedIntentRecognizer[T], error) {
+func NewToolBasedIntentRecognizer[T any](chatModel model.BaseChatModel, opts ...ParserOption[T]) (*ToolBasedIntentRecognizer[T], error) {
 	options := newIntentRecognizerOptions[T](opts...)
 	chain, err := structured.NewChain[*types.ToolRequest[T], parseCommandInput](
 		chatModel,
-		options.promptBuilder(fmt.Sprintf(options.systemPromptTemplate, parseIntentToolName)),
+		types.LimitHistory(options.historyPolicy, options.promptBuilder(fmt.Sprintf(options.systemPromptTemplate, parseIntentToolName))),
 		parseIntentToolName,
 		parseIntentToolDescription,
 	)
 	if err != nil {
 		return nil, err
 	}
+	chain.MaxAttempts = options.maxAttempts
+	if options.strategy != "" {
+		chain.Strategy = options.strategy
+	}
+	chain.Validator = func(ctx context.Context, output *parseCommandInput) error {
+		if output.Intent == "" {
+			return fmt.Errorf("intent is required")
+		}
+		if !output.Intent.Valid() {
+			return fmt.Errorf("unknown intent %q, must be one of %v", output.Intent, Intents)
+		}
+		return nil
+	}
 	return &ToolBasedIntentRecognizer[T]{Chain: chain}, nil
 }
 
@@ -107,5 +145,8 @@ func (p *ToolBasedIntentRecognizer[T]) RecognizerIntent(ctx context.Context, req
 	if result == nil || result.Intent == "" {
 		return DoNothing, fmt.Errorf("empty intent returned by %s", parseIntentToolName)
 	}
+	if !result.Intent.Valid() {
+		return DoNothing, fmt.Errorf("unknown intent %q returned by %s", result.Intent, parseIntentToolName)
+	}
 	return result.Intent, nil
 }
@@ -2,6 +2,7 @@ package indent
 
 import (
 	"context"
+	"slices"
 
 	"github.com/tbxark/formagent/types"
 )
@@ -12,9 +13,20 @@ const (
 	Cancel    Intent = "cancel"
 	Confirm   Intent = "confirm"
 	Edit      Intent = "edit"
+	Undo      Intent = "undo"
+	Redo      Intent = "redo"
+	Reset     Intent = "reset"
 	DoNothing Intent = "do_nothing"
 )
 
+// Intents lists every intent a Recognizer may return.
+var Intents = []Intent{Cancel, Confirm, Edit, Undo, Redo, Reset, DoNothing}
+
+// Valid reports whether i is one of Intents.
+func (i Intent) Valid() bool {
+	return slices.Contains(Intents, i)
+}
+
 type Recognizer[T any] interface {
 	RecognizerIntent(ctx context.Context, req *types.ToolRequest[T]) (Intent, error)
 }
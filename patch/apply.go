@@ -3,6 +3,7 @@ package patch
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -72,12 +73,105 @@ func FixOperation(currentJSON []byte, ops []Operation) []Operation {
 	return fixed
 }
 
+// ApplyRFC6902WithInverse applies ops like ApplyRFC6902 and also returns the operations
+// that revert the change, in the order they must be applied. It fails without applying
+// anything if an operation cannot be inverted, such as move, copy or test.
+func ApplyRFC6902WithInverse[T any](current T, ops []Operation) (T, []Operation, error) {
+	var zero T
+
+	if len(ops) == 0 {
+		return current, nil, nil
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return zero, nil, fmt.Errorf("failed to marshal current state: %w", err)
+	}
+
+	ops = FixOperation(currentJSON, ops)
+
+	inverse := make([]Operation, 0, len(ops))
+	docJSON := currentJSON
+	for _, op := range ops {
+		var doc any
+		if err := json.Unmarshal(docJSON, &doc); err != nil {
+			return zero, nil, fmt.Errorf("failed to unmarshal current state: %w", err)
+		}
+		inv, ok := invertOperation(doc, op)
+		if !ok {
+			return zero, nil, fmt.Errorf("%s operation on %s cannot be undone", op.Op, op.Path)
+		}
+		inverse = append(inverse, inv)
+		patchJSON, err := json.Marshal([]Operation{op})
+		if err != nil {
+			return zero, nil, fmt.Errorf("failed to marshal patch operations: %w", err)
+		}
+		patch, err := jsonpatch.DecodePatch(patchJSON)
+		if err != nil {
+			return zero, nil, fmt.Errorf("failed to decode patch: %w", err)
+		}
+		docJSON, err = patch.Apply(docJSON)
+		if err != nil {
+			return zero, nil, fmt.Errorf("failed to apply patch: %w", err)
+		}
+	}
+
+	var result T
+	if err := json.Unmarshal(docJSON, &result); err != nil {
+		return zero, nil, fmt.Errorf("type mismatch: patch would result in invalid type T: %w", err)
+	}
+
+	slices.Reverse(inverse)
+	return result, inverse, nil
+}
+
+func invertOperation(doc any, op Operation) (Operation, bool) {
+	switch op.Op {
+	case OperationAdd:
+		parentPath, last := splitPath(op.Path)
+		if parent, ok := lookupPath(doc, parentPath); ok {
+			if arr, isArr := parent.([]any); isArr {
+				if last == "-" {
+					return Operation{Op: OperationRemove, Path: parentPath + "/" + strconv.Itoa(len(arr))}, true
+				}
+				return Operation{Op: OperationRemove, Path: op.Path}, true
+			}
+		}
+		if old, ok := lookupPath(doc, op.Path); ok {
+			return Operation{Op: OperationReplace, Path: op.Path, Value: old}, true
+		}
+		return Operation{Op: OperationRemove, Path: op.Path}, true
+	case OperationReplace:
+		if old, ok := lookupPath(doc, op.Path); ok {
+			return Operation{Op: OperationReplace, Path: op.Path, Value: old}, true
+		}
+	case OperationRemove:
+		if old, ok := lookupPath(doc, op.Path); ok {
+			return Operation{Op: OperationAdd, Path: op.Path, Value: old}, true
+		}
+	}
+	return Operation{}, false
+}
+
+func splitPath(path string) (string, string) {
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 {
+		return "", path
+	}
+	return path[:idx], path[idx+1:]
+}
+
 func pathExists(doc any, path string) bool {
+	_, ok := lookupPath(doc, path)
+	return ok
+}
+
+func lookupPath(doc any, path string) (any, bool) {
 	if path == "" {
-		return true
+		return doc, true
 	}
 	if !strings.HasPrefix(path, "/") {
-		return false
+		return nil, false
 	}
 
 	tokens := strings.Split(path[1:], "/")
@@ -89,19 +183,19 @@ func pathExists(doc any, path string) bool {
 		case map[string]any:
 			value, ok := node[token]
 			if !ok {
-				return false
+				return nil, false
 			}
 			cur = value
 		case []any:
 			index, err := strconv.Atoi(token)
 			if err != nil || index < 0 || index >= len(node) {
-				return false
+				return nil, false
 			}
 			cur = node[index]
 		default:
-			return false
+			return nil, false
 		}
 	}
 
-	return true
+	return cur, true
 }
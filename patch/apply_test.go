@@ -0,0 +1,71 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testForm struct {
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Note  string   `json:"note,omitempty"`
+}
+
+func TestApplyRFC6902WithInverse(t *testing.T) {
+	current := testForm{Title: "old", Tags: []string{"a"}, Note: "keep me"}
+	ops := []Operation{
+		{Op: OperationReplace, Path: "/title", Value: "new"},
+		{Op: OperationAdd, Path: "/tags/-", Value: "b"},
+		{Op: OperationRemove, Path: "/note"},
+	}
+	updated, inverse, err := ApplyRFC6902WithInverse(current, ops)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := testForm{Title: "new", Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(updated, want) {
+		t.Fatalf("unexpected state: %+v", updated)
+	}
+	reverted, err := ApplyRFC6902(updated, inverse)
+	if err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	if !reflect.DeepEqual(reverted, current) {
+		t.Fatalf("revert mismatch: got %+v, want %+v", reverted, current)
+	}
+}
+
+func TestApplyRFC6902WithInverse_NotInvertible(t *testing.T) {
+	current := testForm{Title: "old", Note: "keep me"}
+	for _, op := range []Operation{
+		{Op: "test", Path: "/title", Value: "new"},
+		{Op: "move", Path: "/note"},
+		{Op: "copy", Path: "/note"},
+	} {
+		ops := []Operation{{Op: OperationReplace, Path: "/title", Value: "new"}, op}
+		if _, inverse, err := ApplyRFC6902WithInverse(current, ops); err == nil {
+			t.Fatalf("%s %s: applied with partial inverse %v", op.Op, op.Path, inverse)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := &History{}
+	for i := 0; i < 3; i++ {
+		h.Push(Record{Ops: []Operation{{Op: OperationAdd, Path: "/title", Value: i}}}, 2)
+	}
+	if len(h.Undo) != 2 {
+		t.Fatalf("expected history to be bounded to 2, got %d", len(h.Undo))
+	}
+	rec, ok := h.PopUndo()
+	if !ok || rec.Ops[0].Value != 2 {
+		t.Fatalf("unexpected undo record: %+v", rec)
+	}
+	rec, ok = h.PopRedo()
+	if !ok || rec.Ops[0].Value != 2 {
+		t.Fatalf("unexpected redo record: %+v", rec)
+	}
+	if _, ok := h.PopRedo(); ok {
+		t.Fatal("redo stack should be empty")
+	}
+}
@@ -0,0 +1,61 @@
+package patch
+
+const DefaultHistoryLimit = 20
+
+// Record is a batch of operations applied in one turn together with the operations
+// that revert it.
+type Record struct {
+	Ops     []Operation `json:"ops"`
+	Inverse []Operation `json:"inverse"`
+}
+
+// History is a bounded undo/redo stack of applied patch batches.
+type History struct {
+	Undo []Record `json:"undo,omitempty"`
+	Redo []Record `json:"redo,omitempty"`
+}
+
+// Push records a newly applied batch, dropping the oldest entries beyond limit and
+// discarding anything that could have been redone.
+func (h *History) Push(rec Record, limit int) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	h.Undo = append(h.Undo, rec)
+	if over := len(h.Undo) - limit; over > 0 {
+		h.Undo = append([]Record(nil), h.Undo[over:]...)
+	}
+	h.Redo = nil
+}
+
+// PopUndo removes the most recent batch and makes it available to PopRedo.
+func (h *History) PopUndo() (Record, bool) {
+	if len(h.Undo) == 0 {
+		return Record{}, false
+	}
+	rec := h.Undo[len(h.Undo)-1]
+	h.Undo = h.Undo[:len(h.Undo)-1]
+	h.Redo = append(h.Redo, rec)
+	return rec, true
+}
+
+// PopRedo removes the most recently undone batch and puts it back on the undo stack.
+func (h *History) PopRedo() (Record, bool) {
+	if len(h.Redo) == 0 {
+		return Record{}, false
+	}
+	rec := h.Redo[len(h.Redo)-1]
+	h.Redo = h.Redo[:len(h.Redo)-1]
+	h.Undo = append(h.Undo, rec)
+	return rec, true
+}
+
+func (h *History) Clone() *History {
+	if h == nil {
+		return &History{}
+	}
+	return &History{
+		Undo: append([]Record(nil), h.Undo...),
+		Redo: append([]Record(nil), h.Redo...),
+	}
+}
@@ -0,0 +1,78 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/eino-contrib/jsonschema"
+)
+
+// SchemaTypes returns the JSON types a schema allows, or nil when it does not restrict
+// the type.
+func SchemaTypes(schema *jsonschema.Schema) []string {
+	if len(schema.TypeEnhanced) > 0 {
+		return schema.TypeEnhanced
+	}
+	if schema.Type != "" {
+		return []string{schema.Type}
+	}
+	return nil
+}
+
+// MatchesSchemaType reports whether a decoded JSON value has one of the allowed JSON
+// types. Integers match "number", and type names JSON Schema does not define match any
+// value.
+func MatchesSchemaType(allowed []string, value any) bool {
+	actual := JSONTypeOf(value)
+	for _, t := range allowed {
+		switch t {
+		case "number":
+			if actual == "number" || actual == "integer" {
+				return true
+			}
+		case "null", "string", "boolean", "object", "array", "integer":
+			if actual == t {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// JSONTypeOf returns the JSON Schema type name of a decoded JSON value. Whole numbers
+// are reported as "integer"; values that are not JSON return their Go type.
+func JSONTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		return numberType(v)
+	case float32:
+		return numberType(float64(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return numberType(f)
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func numberType(n float64) string {
+	if n == math.Trunc(n) {
+		return "integer"
+	}
+	return "number"
+}
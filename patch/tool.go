@@ -24,6 +24,7 @@ General rules:
 - Only use information explicitly provided by the user in this turn. Do not infer or guess.
 - Output only valid RFC6902 JSON Patch operations. If there is nothing to update, return an empty operations list.
 - Do NOT include unchanged fields. Do NOT include operations with empty/unknown values unless the user explicitly says so.
+- Resolve relative dates and times (e.g., "today", "yesterday", "昨天", "下周一") against the Current Date section, in its time zone.
 
 RFC6902 / JSON Patch rules (MUST follow):
 1) Operation types:
@@ -67,6 +68,10 @@ type PromptBuilder[T any] func(systemPrompt string) func(ctx context.Context, re
 type patchGeneratorOptions[T any] struct {
 	systemPromptTemplate string
 	promptBuilder        PromptBuilder[T]
+	historyPolicy        *types.HistoryPolicy
+	maxAttempts          int
+	strategy             structured.Strategy
+	outputValidator      func(ctx context.Context, args *UpdateFormArgs) error
 }
 
 type GeneratorOption[T any] func(*patchGeneratorOptions[T])
@@ -83,21 +88,46 @@ func WithPatchPromptBuilder[T any](promptBuilder PromptBuilder[T]) GeneratorOpti
 	}
 }
 
+// WithPatchPromptRenderer renders the user prompt with renderer instead of the default
+// sections; it replaces any prompt builder set before it.
+func WithPatchPromptRenderer[T any](renderer *types.PromptRenderer[T]) GeneratorOption[T] {
+	return WithPatchPromptBuilder[T](renderer.PromptBuilder)
+}
+
+// WithPatchHistoryPolicy limits the chat history rendered into the prompt, whichever
+// prompt builder is used.
+func WithPatchHistoryPolicy[T any](policy types.HistoryPolicy) GeneratorOption[T] {
+	return func(o *patchGeneratorOptions[T]) {
+		o.historyPolicy = &policy
+	}
+}
+
+// WithPatchStrategy selects how structured output is obtained from the model. Use
+// structured.StrategyJSONPrompt for models without tool calling support.
+func WithPatchStrategy[T any](strategy structured.Strategy) GeneratorOption[T] {
+	return func(o *patchGeneratorOptions[T]) {
+		o.strategy = strategy
+	}
+}
+
+// WithPatchMaxAttempts lets the generator re-ask the model, with the parse or validation
+// error attached, when it returns an unusable tool call.
+func WithPatchMaxAttempts[T any](maxAttempts int) GeneratorOption[T] {
+	return func(o *patchGeneratorOptions[T]) {
+		o.maxAttempts = maxAttempts
+	}
+}
+
+func WithPatchOutputValidator[T any](validator func(ctx context.Context, args *UpdateFormArgs) error) GeneratorOption[T] {
+	return func(o *patchGeneratorOptions[T]) {
+		o.outputValidator = validator
+	}
+}
+
 func newPatchGeneratorOptions[T any](opts ...GeneratorOption[T]) *patchGeneratorOptions[T] {
 	opt := patchGeneratorOptions[T]{
 		systemPromptTemplate: DefaultUpdateFormSystemPromptTemplate,
-		promptBuilder: func(systemPrompt string) func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-			return func(ctx context.Context, req *types.ToolRequest[T]) ([]*schema.Message, error) {
-				message, err := types.FormatToolRequest(req)
-				if err != nil {
-					return nil, fmt.Errorf("convert to prompt message failed: %w", err)
-				}
-				return []*schema.Message{
-					schema.SystemMessage(systemPrompt),
-					schema.UserMessage(message),
-				}, nil
-			}
-		},
+		promptBuilder:        types.DefaultPromptRenderer[T]().PromptBuilder,
 	}
 	for _, o := range opts {
 		o(&opt)
@@ -109,17 +139,22 @@ type ToolBasedPatchGenerator[T any] struct {
 	Chain *structured.Chain[*types.ToolRequest[T], UpdateFormArgs]
 }
 
-func NewToolBasedPatchGenerator[T any](chatModel model.ToolCallingChatModel, opts ...GeneratorOption[T]) (*ToolBasedPatchGenerator[T], error) {
+func NewToolBasedPatchGenerator[T any](chatModel model.BaseChatModel, opts ...GeneratorOption[T]) (*ToolBasedPatchGenerator[T], error) {
 	options := newPatchGeneratorOptions(opts...)
 	chain, err := structured.NewChain[*types.ToolRequest[T], UpdateFormArgs](
 		chatModel,
-		options.promptBuilder(fmt.Sprintf(options.systemPromptTemplate, updateFormToolName)),
+		types.LimitHistory(options.historyPolicy, options.promptBuilder(fmt.Sprintf(options.systemPromptTemplate, updateFormToolName))),
 		updateFormToolName,
 		updateFormToolDescription,
 	)
 	if err != nil {
 		return nil, err
 	}
+	chain.MaxAttempts = options.maxAttempts
+	if options.strategy != "" {
+		chain.Strategy = options.strategy
+	}
+	chain.Validator = options.outputValidator
 	return &ToolBasedPatchGenerator[T]{Chain: chain}, nil
 }
 
@@ -0,0 +1,197 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eino-contrib/jsonschema"
+)
+
+// Rejection describes an operation that failed validation.
+type Rejection struct {
+	Operation Operation `json:"operation"`
+	Reason    string    `json:"reason"`
+}
+
+// Validator filters generated operations before they are applied.
+type Validator interface {
+	Validate(ops []Operation) (accepted []Operation, rejected []Rejection)
+}
+
+// SchemaValidator rejects operations whose path is not declared in a JSON schema or
+// whose value does not match the declared type.
+type SchemaValidator struct {
+	root *jsonschema.Schema
+}
+
+var _ Validator = (*SchemaValidator)(nil)
+
+func NewSchemaValidator(schema *jsonschema.Schema) *SchemaValidator {
+	return &SchemaValidator{root: schema}
+}
+
+func NewSchemaValidatorFromJSON(schemaJSON string) (*SchemaValidator, error) {
+	var schema jsonschema.Schema
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+	return NewSchemaValidator(&schema), nil
+}
+
+func NewSchemaValidatorFor[T any]() *SchemaValidator {
+	reflector := &jsonschema.Reflector{DoNotReference: true}
+	return NewSchemaValidator(reflector.ReflectFromType(reflect.TypeFor[T]()))
+}
+
+func (v *SchemaValidator) Validate(ops []Operation) ([]Operation, []Rejection) {
+	accepted := make([]Operation, 0, len(ops))
+	var rejected []Rejection
+	for _, op := range ops {
+		if reason := v.check(op); reason != "" {
+			rejected = append(rejected, Rejection{Operation: op, Reason: reason})
+			continue
+		}
+		accepted = append(accepted, op)
+	}
+	return accepted, rejected
+}
+
+func (v *SchemaValidator) check(op Operation) string {
+	switch op.Op {
+	case OperationAdd, OperationReplace, OperationRemove:
+	default:
+		return fmt.Sprintf("unsupported operation %q", op.Op)
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		return fmt.Sprintf("path %q must start with '/'", op.Path)
+	}
+	schema, reason := v.lookup(op.Path, op.Op == OperationAdd)
+	if reason != "" {
+		return reason
+	}
+	if op.Op == OperationRemove {
+		return ""
+	}
+	return v.checkValue(schema, op.Value, op.Path)
+}
+
+// lookup resolves the sub-schema addressed by a JSON pointer. The "-" array token is
+// only accepted when appending.
+func (v *SchemaValidator) lookup(path string, appending bool) (*jsonschema.Schema, string) {
+	cur := v.resolve(v.root)
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+		if cur == nil {
+			return nil, ""
+		}
+		switch {
+		case cur.Items != nil || hasType(cur, "array"):
+			if token == "-" {
+				if !appending || i != len(tokens)-1 {
+					return nil, fmt.Sprintf("path %q uses '-' outside of an append", path)
+				}
+			} else if index, err := strconv.Atoi(token); err != nil || index < 0 {
+				return nil, fmt.Sprintf("path %q has invalid array index %q", path, token)
+			}
+			cur = v.resolve(cur.Items)
+		default:
+			if types := SchemaTypes(cur); len(types) > 0 && !hasType(cur, "object") {
+				return nil, fmt.Sprintf("path %q goes below a %s value", path, strings.Join(types, " or "))
+			}
+			next, ok := propertySchema(cur, token)
+			if !ok {
+				return nil, fmt.Sprintf("path %q is not defined in the form schema", path)
+			}
+			cur = v.resolve(next)
+		}
+	}
+	return cur, ""
+}
+
+func (v *SchemaValidator) checkValue(schema *jsonschema.Schema, value any, path string) string {
+	schema = v.resolve(schema)
+	if schema == nil {
+		return ""
+	}
+	allowed := SchemaTypes(schema)
+	if len(allowed) > 0 && !MatchesSchemaType(allowed, value) {
+		return fmt.Sprintf("value at %q should be %s, got %s", path, strings.Join(allowed, " or "), JSONTypeOf(value))
+	}
+	switch val := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(val)) {
+			child := val[key]
+			childPath := path + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+			next, ok := propertySchema(schema, key)
+			if !ok {
+				return fmt.Sprintf("path %q is not defined in the form schema", childPath)
+			}
+			if reason := v.checkValue(next, child, childPath); reason != "" {
+				return reason
+			}
+		}
+	case []any:
+		if schema.Items == nil {
+			return ""
+		}
+		for i, item := range val {
+			if reason := v.checkValue(schema.Items, item, path+"/"+strconv.Itoa(i)); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+func (v *SchemaValidator) resolve(schema *jsonschema.Schema) *jsonschema.Schema {
+	for i := 0; schema != nil && schema.Ref != "" && i < 32; i++ {
+		if schema.Ref == "#" {
+			return v.root
+		}
+		name, ok := strings.CutPrefix(schema.Ref, "#/$defs/")
+		if !ok {
+			return nil
+		}
+		schema = v.root.Definitions[name]
+	}
+	return schema
+}
+
+// propertySchema returns the schema of an object member. Members not declared under
+// "properties" are only allowed by an explicit "additionalProperties" schema, or when
+// the object declares no properties at all. A nil schema accepts any value.
+func propertySchema(schema *jsonschema.Schema, key string) (*jsonschema.Schema, bool) {
+	if schema.Properties != nil {
+		if next, ok := schema.Properties.Get(key); ok {
+			return next, true
+		}
+	}
+	if schema.AdditionalProperties != nil {
+		if isFalseSchema(schema.AdditionalProperties) {
+			return nil, false
+		}
+		return schema.AdditionalProperties, true
+	}
+	return nil, schema.Properties == nil || schema.Properties.Len() == 0
+}
+
+func isFalseSchema(schema *jsonschema.Schema) bool {
+	b, err := json.Marshal(schema)
+	return err == nil && string(b) == "false"
+}
+
+func hasType(schema *jsonschema.Schema, t string) bool {
+	for _, st := range SchemaTypes(schema) {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
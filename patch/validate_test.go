@@ -0,0 +1,46 @@
+package patch
+
+import (
+	"testing"
+	"time"
+)
+
+type validateForm struct {
+	Title  string    `json:"title,omitempty"`
+	Amount float64   `json:"amount,omitempty"`
+	Count  int       `json:"count,omitempty"`
+	Date   time.Time `json:"date,omitempty"`
+	Tags   []string  `json:"tags,omitempty"`
+	Extra  map[string]any
+}
+
+func TestSchemaValidator(t *testing.T) {
+	v := NewSchemaValidatorFor[*validateForm]()
+	ops := []Operation{
+		{Op: OperationAdd, Path: "/title", Value: "trip"},
+		{Op: OperationAdd, Path: "/title/foo", Value: "trip"},
+		{Op: OperationReplace, Path: "/date/year", Value: 2024.0},
+		{Op: OperationAdd, Path: "/amount", Value: 12.5},
+		{Op: OperationReplace, Path: "/amount", Value: "12"},
+		{Op: OperationAdd, Path: "/count", Value: 1.5},
+		{Op: OperationAdd, Path: "/date", Value: "2024-01-01T00:00:00Z"},
+		{Op: OperationAdd, Path: "/tags/-", Value: "travel"},
+		{Op: OperationAdd, Path: "/tags/-", Value: 3.0},
+		{Op: OperationAdd, Path: "/unknown", Value: "junk"},
+		{Op: OperationAdd, Path: "/Extra/anything", Value: true},
+		{Op: OperationRemove, Path: "/title"},
+	}
+	accepted, rejected := v.Validate(ops)
+	if len(accepted) != 6 {
+		t.Fatalf("expected 6 accepted ops, got %+v", accepted)
+	}
+	wantRejected := []string{"/title/foo", "/date/year", "/amount", "/count", "/tags/-", "/unknown"}
+	if len(rejected) != len(wantRejected) {
+		t.Fatalf("unexpected rejections: %+v", rejected)
+	}
+	for i, r := range rejected {
+		if r.Operation.Path != wantRejected[i] || r.Reason == "" {
+			t.Fatalf("rejection %d = %+v, want path %s", i, r, wantRejected[i])
+		}
+	}
+}
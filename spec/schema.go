@@ -0,0 +1,416 @@
+package spec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eino-contrib/jsonschema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/patch"
+	"github.com/tbxark/formagent/types"
+)
+
+// SchemaSpec is a FormSpec for untyped forms described by a JSON Schema (draft 2020-12)
+// document. Required properties become missing facts and the type, enum, const,
+// pattern, minimum/maximum, minLength/maxLength, minItems/maxItems and format keywords
+// are checked by ValidateFacts. Local "$ref"s into "$defs" are resolved.
+type SchemaSpec struct {
+	root     *jsonschema.Schema
+	schema   string
+	patterns map[string]*regexp.Regexp
+}
+
+var _ agent.FormSpec[map[string]any] = (*SchemaSpec)(nil)
+
+func NewSchemaSpec(schemaJSON []byte) (*SchemaSpec, error) {
+	var root jsonschema.Schema
+	if err := json.Unmarshal(schemaJSON, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+	s := &SchemaSpec{
+		root:     &root,
+		patterns: map[string]*regexp.Regexp{},
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, schemaJSON); err != nil {
+		return nil, fmt.Errorf("failed to compact JSON schema: %w", err)
+	}
+	s.schema = compact.String()
+	if err := s.compilePatterns(&root, map[*jsonschema.Schema]bool{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func LoadSchemaSpec(path string) (*SchemaSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSchemaSpec(data)
+}
+
+// InitState returns an empty form. FormFlow uses it as StateInit, so the first "add"
+// patch of a new session has an object to add to instead of a nil map.
+func (s *SchemaSpec) InitState(ctx context.Context) map[string]any {
+	return map[string]any{}
+}
+
+func (s *SchemaSpec) JSONSchema() string {
+	return s.schema
+}
+
+// Schema returns the parsed schema document.
+func (s *SchemaSpec) Schema() *jsonschema.Schema {
+	return s.root
+}
+
+func (s *SchemaSpec) MissingFacts(ctx context.Context, current map[string]any) []types.FieldInfo {
+	var missing []types.FieldInfo
+	s.walk(s.root, current, "", "", func(node *schemaNode) {
+		if node.required && isEmptyJSON(node.value, node.present) {
+			missing = append(missing, types.FieldInfo{
+				JSONPointer: node.pointer,
+				DisplayName: node.label,
+				Description: node.schema.Description,
+				Required:    true,
+			})
+		}
+	})
+	return missing
+}
+
+func (s *SchemaSpec) ValidateFacts(ctx context.Context, current map[string]any) []types.FieldInfo {
+	var errs []types.FieldInfo
+	s.walk(s.root, current, "", "", func(node *schemaNode) {
+		if node.pointer == "" || !node.present || node.value == nil {
+			return
+		}
+		for _, msg := range s.validate(node.schema, node.label, node.value) {
+			errs = append(errs, types.FieldInfo{
+				JSONPointer: node.pointer,
+				DisplayName: node.label,
+				Description: msg,
+				Required:    node.required,
+			})
+		}
+	})
+	return errs
+}
+
+func (s *SchemaSpec) Summary(ctx context.Context, current map[string]any) string {
+	var lines strings.Builder
+	if s.root.Title != "" {
+		lines.WriteString(s.root.Title)
+		lines.WriteString("：\n")
+	}
+	s.walk(s.root, current, "", "", func(node *schemaNode) {
+		if node.pointer == "" || isContainerSchema(s.resolve(node.schema)) {
+			return
+		}
+		lines.WriteString(node.label)
+		lines.WriteString("：")
+		if isEmptyJSON(node.value, node.present) {
+			lines.WriteString("（未填写）")
+		} else if str, ok := node.value.(string); ok {
+			lines.WriteString(str)
+		} else {
+			b, _ := json.Marshal(node.value)
+			lines.Write(b)
+		}
+		lines.WriteString("\n")
+	})
+	return formatSummary(lines.String(), current, s.schema)
+}
+
+type schemaNode struct {
+	schema   *jsonschema.Schema
+	value    any
+	present  bool
+	required bool
+	pointer  string
+	label    string
+}
+
+// walk visits the root value and every declared property of objects and items of
+// arrays, in schema order. Absent properties are visited so required ones can be
+// reported, but their children are not.
+func (s *SchemaSpec) walk(schema *jsonschema.Schema, value any, pointer, label string, visit func(node *schemaNode)) {
+	visit(&schemaNode{schema: schema, value: value, present: true, pointer: pointer, label: label})
+	s.walkChildren(schema, value, pointer, label, visit)
+}
+
+func (s *SchemaSpec) walkChildren(schema *jsonschema.Schema, value any, pointer, label string, visit func(node *schemaNode)) {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		if schema.Properties == nil {
+			return
+		}
+		for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			child := s.resolve(pair.Value)
+			childValue, present := v[pair.Key]
+			childLabel := schemaLabel(pair.Value, pair.Key)
+			if label != "" {
+				childLabel = label + " " + childLabel
+			}
+			node := &schemaNode{
+				schema:   pair.Value,
+				value:    childValue,
+				present:  present,
+				required: slices.Contains(schema.Required, pair.Key),
+				pointer:  pointer + "/" + escapePointer(pair.Key),
+				label:    childLabel,
+			}
+			visit(node)
+			if present {
+				s.walkChildren(child, childValue, node.pointer, node.label, visit)
+			}
+		}
+	case []any:
+		if schema.Items == nil {
+			return
+		}
+		for i, item := range v {
+			itemPointer := pointer + "/" + strconv.Itoa(i)
+			s.walk(schema.Items, item, itemPointer, fmt.Sprintf("%s #%d", label, i+1), visit)
+		}
+	}
+}
+
+// resolve follows local "$ref"s of the form "#/$defs/name".
+func (s *SchemaSpec) resolve(schema *jsonschema.Schema) *jsonschema.Schema {
+	for i := 0; schema != nil && schema.Ref != "" && i < 32; i++ {
+		name, ok := strings.CutPrefix(schema.Ref, "#/$defs/")
+		if !ok {
+			if schema.Ref == "#" {
+				return s.root
+			}
+			return schema
+		}
+		def, ok := s.root.Definitions[name]
+		if !ok {
+			return schema
+		}
+		schema = def
+	}
+	return schema
+}
+
+func (s *SchemaSpec) compilePatterns(schema *jsonschema.Schema, seen map[*jsonschema.Schema]bool) error {
+	if schema == nil || seen[schema] {
+		return nil
+	}
+	seen[schema] = true
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", schema.Pattern, err)
+		}
+		s.patterns[schema.Pattern] = re
+	}
+	children := []*jsonschema.Schema{schema.Items}
+	if schema.Properties != nil {
+		for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			children = append(children, pair.Value)
+		}
+	}
+	for _, def := range schema.Definitions {
+		children = append(children, def)
+	}
+	for _, child := range children {
+		if err := s.compilePatterns(child, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SchemaSpec) validate(schema *jsonschema.Schema, label string, value any) []string {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if allowed := patch.SchemaTypes(schema); len(allowed) > 0 && !patch.MatchesSchemaType(allowed, value) {
+		return []string{fmt.Sprintf("%s的类型应为%s", label, strings.Join(allowed, "或"))}
+	}
+	var errs []string
+	if len(schema.Enum) > 0 && !containsJSON(schema.Enum, value) {
+		options := make([]string, 0, len(schema.Enum))
+		for _, e := range schema.Enum {
+			options = append(options, fmt.Sprint(e))
+		}
+		errs = append(errs, fmt.Sprintf("%s必须是以下之一：%s", label, strings.Join(options, "、")))
+	}
+	if schema.Const != nil && !jsonEqual(schema.Const, value) {
+		errs = append(errs, fmt.Sprintf("%s必须为%v", label, schema.Const))
+	}
+	switch v := value.(type) {
+	case string:
+		n := uint64(len([]rune(v)))
+		if schema.MinLength != nil && n < *schema.MinLength {
+			errs = append(errs, fmt.Sprintf("%s长度不能少于%d个字符", label, *schema.MinLength))
+		}
+		if schema.MaxLength != nil && n > *schema.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s长度不能超过%d个字符", label, *schema.MaxLength))
+		}
+		if re := s.patterns[schema.Pattern]; re != nil && !re.MatchString(v) {
+			errs = append(errs, fmt.Sprintf("%s格式不正确", label))
+		}
+		if schema.Format != "" && !matchesFormat(schema.Format, v) {
+			errs = append(errs, fmt.Sprintf("%s不是有效的%s格式", label, schema.Format))
+		}
+	case []any:
+		n := uint64(len(v))
+		if schema.MinItems != nil && n < *schema.MinItems {
+			errs = append(errs, fmt.Sprintf("%s至少需要%d项", label, *schema.MinItems))
+		}
+		if schema.MaxItems != nil && n > *schema.MaxItems {
+			errs = append(errs, fmt.Sprintf("%s最多只能有%d项", label, *schema.MaxItems))
+		}
+	default:
+		n, ok := toNumber(value)
+		if !ok {
+			break
+		}
+		if limit, ok := numberKeyword(schema.Minimum); ok && n < limit {
+			errs = append(errs, fmt.Sprintf("%s不能小于%v", label, limit))
+		}
+		if limit, ok := numberKeyword(schema.Maximum); ok && n > limit {
+			errs = append(errs, fmt.Sprintf("%s不能大于%v", label, limit))
+		}
+		if limit, ok := numberKeyword(schema.ExclusiveMinimum); ok && n <= limit {
+			errs = append(errs, fmt.Sprintf("%s必须大于%v", label, limit))
+		}
+		if limit, ok := numberKeyword(schema.ExclusiveMaximum); ok && n >= limit {
+			errs = append(errs, fmt.Sprintf("%s必须小于%v", label, limit))
+		}
+	}
+	return errs
+}
+
+func schemaLabel(schema *jsonschema.Schema, name string) string {
+	if schema != nil && schema.Title != "" {
+		return schema.Title
+	}
+	return name
+}
+
+func isContainerSchema(schema *jsonschema.Schema) bool {
+	if schema == nil {
+		return false
+	}
+	for _, t := range patch.SchemaTypes(schema) {
+		if t == "object" || t == "array" {
+			return true
+		}
+	}
+	return schema.Properties != nil && schema.Properties.Len() > 0
+}
+
+var (
+	uuidFormatPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// matchesFormat checks the common string formats; unknown formats are accepted.
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		if err != nil {
+			_, err = time.Parse(time.TimeOnly, value)
+		}
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidFormatPattern.MatchString(value)
+	}
+	return true
+}
+
+func toNumber(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func numberKeyword(n json.Number) (float64, bool) {
+	if n == "" {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func isEmptyJSON(value any, present bool) bool {
+	if !present || value == nil {
+		return true
+	}
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func containsJSON(values []any, value any) bool {
+	for _, v := range values {
+		if jsonEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
@@ -0,0 +1,104 @@
+package spec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+)
+
+const expenseSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "报销单",
+  "type": "object",
+  "required": ["title", "amount", "date", "items"],
+  "properties": {
+    "title": {"type": "string", "title": "报销抬头", "minLength": 2},
+    "amount": {"type": "number", "title": "金额", "minimum": 0},
+    "date": {"type": "string", "title": "日期", "format": "date"},
+    "category": {"type": "string", "title": "类别", "enum": ["travel", "meal"]},
+    "email": {"type": "string", "title": "邮箱", "format": "email"},
+    "code": {"type": "string", "title": "编号", "pattern": "^[A-Z]{3}$"},
+    "items": {"type": "array", "title": "明细", "items": {"$ref": "#/$defs/item"}}
+  },
+  "$defs": {
+    "item": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string", "title": "名称"},
+        "count": {"type": "integer", "title": "数量", "maximum": 10}
+      }
+    }
+  }
+}`
+
+func TestSchemaSpec(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSchemaSpec([]byte(expenseSchema))
+	if err != nil {
+		t.Fatalf("NewSchemaSpec failed: %v", err)
+	}
+
+	form := map[string]any{
+		"title":    "A",
+		"amount":   "12",
+		"date":     "2024/01/01",
+		"category": "other",
+		"email":    "not-an-email",
+		"code":     "abc",
+		"items":    []any{map[string]any{"count": 1.5}, map[string]any{"name": "taxi", "count": float64(11)}},
+	}
+	missing := pointers(s.MissingFacts(ctx, form))
+	if strings.Join(missing, ",") != "/items/0/name" {
+		t.Fatalf("missing = %v", missing)
+	}
+
+	invalid := pointers(s.ValidateFacts(ctx, form))
+	want := []string{"/title", "/amount", "/date", "/category", "/email", "/code", "/items/0/count", "/items/1/count"}
+	if strings.Join(invalid, ",") != strings.Join(want, ",") {
+		t.Fatalf("invalid = %v, want %v", invalid, want)
+	}
+
+	missing = pointers(s.MissingFacts(ctx, map[string]any{}))
+	if strings.Join(missing, ",") != "/title,/amount,/date,/items" {
+		t.Fatalf("missing on empty form = %v", missing)
+	}
+
+	summary := s.Summary(ctx, form)
+	for _, want := range []string{"报销单", "报销抬头：A", "明细 #2 名称：taxi", "类别：other"} {
+		if !strings.Contains(summary, want) {
+			t.Fatalf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestSchemaSpec_FirstEdit(t *testing.T) {
+	s, err := NewSchemaSpec([]byte(expenseSchema))
+	if err != nil {
+		t.Fatalf("NewSchemaSpec failed: %v", err)
+	}
+	m := formagenttest.NewFakeChatModel()
+	m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+	m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"差旅"}]}`)
+	m.OnText().ReplyText("金额是多少？")
+	flow, err := agent.NewToolBasedFormFlow[map[string]any](s, m)
+	if err != nil {
+		t.Fatalf("NewToolBasedFormFlow failed: %v", err)
+	}
+
+	// a new session from a store without an initializer starts with a nil map
+	resp, err := flow.Invoke(context.Background(), &agent.Request[map[string]any]{
+		State:       &agent.State[map[string]any]{},
+		ChatHistory: []*schema.Message{schema.UserMessage("差旅报销")},
+	})
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if resp.State.FormState["title"] != "差旅" || len(resp.Report.RejectedOps) != 0 {
+		t.Fatalf("first edit not applied: %+v, rejected %+v", resp.State.FormState, resp.Report.RejectedOps)
+	}
+}
@@ -0,0 +1,514 @@
+package spec
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eino-contrib/jsonschema"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/types"
+)
+
+// TagSpec is a FormSpec derived from struct tags. Each field may carry a `form` tag,
+// for example `form:"required,label=金额,min=0"`, with the following keys:
+//
+//	required        the field must be non-zero
+//	label=...       display name, defaults to the jsonschema description or the JSON name
+//	desc=...        description shown to the user
+//	min=, max=      numeric bounds
+//	minlen=, maxlen= length bounds for strings and slices
+//	pattern=...     regular expression for strings (must not contain commas)
+//	enum=...        allowed value, may be repeated
+//
+// Nested structs and slices of structs are walked recursively and reported with
+// JSON pointers such as "/items/0/amount". The `jsonschema` tag's required and
+// description keys are honoured as well.
+type TagSpec[T any] struct {
+	title  string
+	schema string
+	rules  ruleSet
+}
+
+var _ agent.FormSpec[any] = (*TagSpec[any])(nil)
+
+type TagSpecOption func(*tagSpecOptions)
+
+type tagSpecOptions struct {
+	title       string
+	description string
+}
+
+func WithTitle(title string) TagSpecOption {
+	return func(o *tagSpecOptions) {
+		o.title = title
+	}
+}
+
+func WithDescription(description string) TagSpecOption {
+	return func(o *tagSpecOptions) {
+		o.description = description
+	}
+}
+
+func NewTagSpec[T any](opts ...TagSpecOption) (*TagSpec[T], error) {
+	var options tagSpecOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("tag spec requires a struct type, got %s", t)
+	}
+	rules := ruleSet{}
+	if err := rules.compile(t); err != nil {
+		return nil, err
+	}
+	reflector := &jsonschema.Reflector{
+		DoNotReference:             true,
+		RequiredFromJSONSchemaTags: true,
+	}
+	schema := reflector.ReflectFromType(t)
+	schema.Title = options.title
+	schema.Description = options.description
+	schemaBytes, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON schema: %w", err)
+	}
+	return &TagSpec[T]{
+		title:  options.title,
+		schema: string(schemaBytes),
+		rules:  rules,
+	}, nil
+}
+
+func (s *TagSpec[T]) JSONSchema() string {
+	return s.schema
+}
+
+func (s *TagSpec[T]) MissingFacts(ctx context.Context, current T) []types.FieldInfo {
+	var missing []types.FieldInfo
+	s.rules.walk(reflect.ValueOf(current), "", "", func(f *formField) {
+		if f.rule.required && isEmptyValue(f.value) {
+			missing = append(missing, types.FieldInfo{
+				JSONPointer: f.pointer,
+				DisplayName: f.label,
+				Description: f.rule.description,
+				Required:    true,
+			})
+		}
+	})
+	return missing
+}
+
+func (s *TagSpec[T]) ValidateFacts(ctx context.Context, current T) []types.FieldInfo {
+	var errs []types.FieldInfo
+	s.rules.walk(reflect.ValueOf(current), "", "", func(f *formField) {
+		if isEmptyValue(f.value) {
+			return
+		}
+		for _, msg := range f.rule.validate(f.label, f.value) {
+			errs = append(errs, types.FieldInfo{
+				JSONPointer: f.pointer,
+				DisplayName: f.label,
+				Description: msg,
+				Required:    f.rule.required,
+			})
+		}
+	})
+	return errs
+}
+
+func (s *TagSpec[T]) Summary(ctx context.Context, current T) string {
+	var lines strings.Builder
+	if s.title != "" {
+		lines.WriteString(s.title)
+		lines.WriteString("：\n")
+	}
+	s.rules.walk(reflect.ValueOf(current), "", "", func(f *formField) {
+		if f.nested {
+			return
+		}
+		lines.WriteString(f.label)
+		lines.WriteString("：")
+		lines.WriteString(formatValue(f.value))
+		lines.WriteString("\n")
+	})
+	return formatSummary(lines.String(), current, s.schema)
+}
+
+func formatSummary(lines string, current any, schema string) string {
+	var sb strings.Builder
+	sb.WriteString("## Summary：\n")
+	sb.WriteString(types.WrapMarkdownCodeBlock(strings.TrimRight(lines, "\n"), "markdown"))
+	if stateJson, err := json.Marshal(current); err == nil {
+		sb.WriteString("\n\n## Form state json:\n```json\n")
+		sb.WriteString(string(stateJson))
+		sb.WriteString("\n```\n")
+	}
+	sb.WriteString("\n\n## Form state schema:\n```json\n")
+	sb.WriteString(schema)
+	sb.WriteString("\n```\n")
+	return sb.String()
+}
+
+type fieldRule struct {
+	required    bool
+	label       string
+	description string
+	min         *float64
+	max         *float64
+	minLen      *int
+	maxLen      *int
+	pattern     *regexp.Regexp
+	enum        []string
+}
+
+func parseFieldRule(field reflect.StructField) (*fieldRule, error) {
+	rule := &fieldRule{}
+	for _, part := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "required":
+			rule.required = true
+		case "description":
+			rule.label = value
+		}
+	}
+	tag, ok := field.Tag.Lookup("form")
+	if !ok {
+		return rule, nil
+	}
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch key {
+		case "":
+		case "required":
+			rule.required = true
+		case "label":
+			rule.label = value
+		case "desc":
+			rule.description = value
+		case "min":
+			rule.min, err = parseFloat(value)
+		case "max":
+			rule.max, err = parseFloat(value)
+		case "minlen":
+			rule.minLen, err = parseInt(value)
+		case "maxlen":
+			rule.maxLen, err = parseInt(value)
+		case "pattern":
+			rule.pattern, err = regexp.Compile(value)
+		case "enum":
+			rule.enum = append(rule.enum, value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid form tag on field %s: %w", field.Name, err)
+		}
+	}
+	return rule, nil
+}
+
+func parseFloat(value string) (*float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func parseInt(value string) (*int, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (r *fieldRule) validate(label string, v reflect.Value) []string {
+	v = indirect(v)
+	var errs []string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		n := toFloat(v)
+		if r.min != nil && n < *r.min {
+			errs = append(errs, fmt.Sprintf("%s不能小于%v", label, *r.min))
+		}
+		if r.max != nil && n > *r.max {
+			errs = append(errs, fmt.Sprintf("%s不能大于%v", label, *r.max))
+		}
+	case reflect.String:
+		str := v.String()
+		n := len([]rune(str))
+		if r.minLen != nil && n < *r.minLen {
+			errs = append(errs, fmt.Sprintf("%s长度不能少于%d个字符", label, *r.minLen))
+		}
+		if r.maxLen != nil && n > *r.maxLen {
+			errs = append(errs, fmt.Sprintf("%s长度不能超过%d个字符", label, *r.maxLen))
+		}
+		if r.pattern != nil && !r.pattern.MatchString(str) {
+			errs = append(errs, fmt.Sprintf("%s格式不正确", label))
+		}
+	case reflect.Slice, reflect.Array:
+		n := v.Len()
+		if r.minLen != nil && n < *r.minLen {
+			errs = append(errs, fmt.Sprintf("%s至少需要%d项", label, *r.minLen))
+		}
+		if r.maxLen != nil && n > *r.maxLen {
+			errs = append(errs, fmt.Sprintf("%s最多只能有%d项", label, *r.maxLen))
+		}
+	}
+	if len(r.enum) > 0 && isScalar(v) && !slices.Contains(r.enum, fmt.Sprint(v.Interface())) {
+		errs = append(errs, fmt.Sprintf("%s必须是以下之一：%s", label, strings.Join(r.enum, "、")))
+	}
+	return errs
+}
+
+type formField struct {
+	rule    *fieldRule
+	value   reflect.Value
+	pointer string
+	label   string
+	nested  bool
+}
+
+// ruleSet holds the parsed rules of every struct type reachable from a form type,
+// indexed like the type's fields. Fields without a rule are skipped.
+type ruleSet map[reflect.Type][]*fieldRule
+
+// compile parses the rules of t and of the struct types it contains.
+func (rs ruleSet) compile(t reflect.Type) error {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isLeafType(t) {
+		return nil
+	}
+	if _, ok := rs[t]; ok {
+		return nil
+	}
+	rules := make([]*fieldRule, t.NumField())
+	rs[t] = rules
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		_, inline, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if !inline {
+			rule, err := parseFieldRule(field)
+			if err != nil {
+				return err
+			}
+			rules[i] = rule
+		}
+		if err := rs.compile(field.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// of returns the rules of t. Types only reachable through interface values are not
+// compiled by NewTagSpec and are parsed on use.
+func (rs ruleSet) of(t reflect.Type) []*fieldRule {
+	if rules, ok := rs[t]; ok {
+		return rules
+	}
+	dynamic := ruleSet{}
+	if err := dynamic.compile(t); err != nil {
+		return nil
+	}
+	return dynamic[t]
+}
+
+// walk visits every tagged field reachable from v in declaration order. Struct values
+// are visited before their children.
+func (rs ruleSet) walk(v reflect.Value, pointer, labelPrefix string, visit func(f *formField)) {
+	v = indirect(v)
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	rules := rs.of(t)
+	for i := 0; i < t.NumField() && i < len(rules); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, inline, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if inline {
+			rs.walk(fv, pointer, labelPrefix, visit)
+			continue
+		}
+		rule := rules[i]
+		if rule == nil {
+			continue
+		}
+		label := rule.label
+		if label == "" {
+			label = name
+		}
+		f := &formField{
+			rule:    rule,
+			value:   fv,
+			pointer: pointer + "/" + escapePointer(name),
+			label:   labelPrefix + label,
+			nested:  isNested(fv.Type()),
+		}
+		visit(f)
+		rs.walkChildren(f, visit)
+	}
+}
+
+func (rs ruleSet) walkChildren(f *formField, visit func(f *formField)) {
+	v := indirect(f.value)
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if isLeafType(v.Type()) {
+			return
+		}
+		rs.walk(v, f.pointer, f.label+" ", visit)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			rs.walk(v.Index(i), f.pointer+"/"+strconv.Itoa(i), fmt.Sprintf("%s #%d ", f.label, i+1), visit)
+		}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (name string, inline bool, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+			return "", true, false
+		}
+		name = field.Name
+	}
+	return name, false, false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// isLeafType reports whether a struct serializes as a scalar, e.g. time.Time.
+func isLeafType(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+func isNested(t reflect.Type) bool {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		return !isLeafType(t)
+	case reflect.Slice, reflect.Array:
+		elem := indirectType(t.Elem())
+		return elem.Kind() == reflect.Struct && !isLeafType(elem)
+	}
+	return false
+}
+
+func isScalar(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return true
+		}
+		return isEmptyValue(v.Elem())
+	}
+	return v.IsZero()
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func formatValue(v reflect.Value) string {
+	if isEmptyValue(v) {
+		return "（未填写）"
+	}
+	v = indirect(v)
+	if isScalar(v) {
+		return fmt.Sprint(v.Interface())
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return strings.Trim(string(b), `"`)
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func escapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
@@ -0,0 +1,85 @@
+package spec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbxark/formagent/types"
+)
+
+type expenseItem struct {
+	Name   string  `json:"name" form:"required,label=名称"`
+	Amount float64 `json:"amount" form:"required,label=金额,min=0"`
+}
+
+type expenseForm struct {
+	Title    string        `json:"title,omitempty" jsonschema:"description=报销抬头" form:"required"`
+	Date     time.Time     `json:"date,omitempty" form:"required,label=日期"`
+	Category string        `json:"category,omitempty" form:"label=类别,enum=travel,enum=meal"`
+	Code     string        `json:"code,omitempty" form:"label=编号,pattern=^[A-Z]{3}$"`
+	Items    []expenseItem `json:"items,omitempty" form:"required,label=明细,minlen=1"`
+	Note     string        `json:"note,omitempty"`
+}
+
+func TestTagSpec(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewTagSpec[*expenseForm](WithTitle("报销单"))
+	if err != nil {
+		t.Fatalf("NewTagSpec failed: %v", err)
+	}
+
+	form := &expenseForm{
+		Category: "other",
+		Code:     "abc",
+		Items:    []expenseItem{{Name: "taxi", Amount: -1}, {}},
+	}
+	missing := pointers(s.MissingFacts(ctx, form))
+	wantMissing := []string{"/title", "/date", "/items/1/name", "/items/1/amount"}
+	if strings.Join(missing, ",") != strings.Join(wantMissing, ",") {
+		t.Fatalf("missing = %v, want %v", missing, wantMissing)
+	}
+	if got := s.MissingFacts(ctx, form)[0].DisplayName; got != "报销抬头" {
+		t.Fatalf("label from jsonschema description = %q", got)
+	}
+
+	invalid := pointers(s.ValidateFacts(ctx, form))
+	wantInvalid := []string{"/category", "/code", "/items/0/amount"}
+	if strings.Join(invalid, ",") != strings.Join(wantInvalid, ",") {
+		t.Fatalf("invalid = %v, want %v", invalid, wantInvalid)
+	}
+
+	summary := s.Summary(ctx, form)
+	for _, want := range []string{"报销单", "明细 #1 名称：taxi", "Form state schema"} {
+		if !strings.Contains(summary, want) {
+			t.Fatalf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestTagSpecInvalidTag(t *testing.T) {
+	type badForm struct {
+		Amount float64 `json:"amount" form:"min=abc"`
+	}
+	if _, err := NewTagSpec[badForm](); err == nil {
+		t.Fatal("expected error for invalid form tag")
+	}
+	type item struct {
+		Code string `json:"code" form:"pattern=^[A-Z{3}$"`
+	}
+	type nestedForm struct {
+		Items []item `json:"items"`
+	}
+	if _, err := NewTagSpec[nestedForm](); err == nil || !strings.Contains(err.Error(), "Code") {
+		t.Fatalf("error = %v, want invalid pattern on nested field", err)
+	}
+}
+
+func pointers(fields []types.FieldInfo) []string {
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, f.JSONPointer)
+	}
+	return out
+}
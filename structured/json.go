@@ -0,0 +1,145 @@
+package structured
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Strategy selects how a Chain obtains structured output from the model.
+type Strategy string
+
+const (
+	// StrategyToolCall forces the model to call the chain's tool and parses its arguments.
+	StrategyToolCall Strategy = "tool_call"
+	// StrategyJSONPrompt describes the tool's JSON schema in the prompt and parses a JSON
+	// object out of the text reply, for models without tool calling support.
+	StrategyJSONPrompt Strategy = "json_prompt"
+)
+
+const jsonPromptInstructionTemplate = `
+## Output format
+Do not call any tools. Instead, reply with exactly one JSON object, wrapped in a ` + "```json" + ` fenced code block, with the arguments for '%s' (%s).
+The JSON object MUST conform to this JSON schema:
+` + "```json" + `
+%s
+` + "```" + `
+Do not add any text before or after the code block.`
+
+// jsonPromptMessages returns a copy of messages with the output format instructions
+// appended to the system prompt, or prepended as a system message if there is none.
+func jsonPromptMessages(messages []*schema.Message, toolInfo *schema.ToolInfo) ([]*schema.Message, error) {
+	instruction, err := jsonPromptInstruction(toolInfo)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*schema.Message, 0, len(messages)+1)
+	if len(messages) > 0 && messages[0].Role == schema.System {
+		system := *messages[0]
+		system.Content = strings.TrimRight(system.Content, "\n") + "\n" + instruction
+		out = append(out, &system)
+		out = append(out, messages[1:]...)
+		return out, nil
+	}
+	out = append(out, schema.SystemMessage(instruction))
+	return append(out, messages...), nil
+}
+
+func jsonPromptInstruction(toolInfo *schema.ToolInfo) (string, error) {
+	schemaText := "{}"
+	if toolInfo.ParamsOneOf != nil {
+		js, err := toolInfo.ParamsOneOf.ToJSONSchema()
+		if err != nil {
+			return "", fmt.Errorf("convert tool params to JSON schema failed: %w", err)
+		}
+		schemaText, err = sonic.MarshalString(js)
+		if err != nil {
+			return "", fmt.Errorf("marshal JSON schema failed: %w", err)
+		}
+	}
+	return fmt.Sprintf(jsonPromptInstructionTemplate, toolInfo.Name, toolInfo.Desc, schemaText), nil
+}
+
+// ExtractJSON finds the JSON object in a model reply. It prefers the first fenced code
+// block, falls back to the outermost braces, and removes trailing commas.
+func ExtractJSON(content string) (string, error) {
+	text := strings.TrimSpace(content)
+	if block, ok := fencedBlock(text); ok {
+		text = block
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return "", errors.New("no JSON object found in model response")
+	}
+	closer := byte('}')
+	if text[start] == '[' {
+		closer = ']'
+	}
+	end := strings.LastIndexByte(text, closer)
+	if end < start {
+		return "", errors.New("unterminated JSON object in model response")
+	}
+	return removeTrailingCommas(text[start : end+1]), nil
+}
+
+func fencedBlock(text string) (string, bool) {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return "", false
+	}
+	fence := "```"
+	for start+len(fence) < len(text) && text[start+len(fence)] == '`' {
+		fence += "`"
+	}
+	body := text[start+len(fence):]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.ContainsAny(body[:nl], "{[") {
+		// skip the language tag
+		body = body[nl+1:]
+	}
+	end := strings.Index(body, fence)
+	if end < 0 {
+		return body, true
+	}
+	return body[:end], true
+}
+
+// removeTrailingCommas drops commas directly followed by a closing bracket, ignoring
+// anything inside string literals.
+func removeTrailingCommas(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			sb.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			j := i + 1
+			for j < len(text) && strings.IndexByte(" \t\r\n", text[j]) >= 0 {
+				j++
+			}
+			if j < len(text) && (text[j] == '}' || text[j] == ']') {
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
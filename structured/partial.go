@@ -0,0 +1,190 @@
+package structured
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type partialFrame struct {
+	object bool
+	state  partialState
+}
+
+type partialState int
+
+const (
+	expectValue partialState = iota
+	expectKey
+	expectColon
+	afterValue
+)
+
+type partialScanner struct {
+	stack   []partialFrame
+	cutLen  int
+	cutTail []partialFrame
+}
+
+// CompletePartialJSON turns a truncated JSON document into a valid one by closing open
+// strings, arrays and objects. Incomplete keys, literals and numbers are dropped. It
+// returns false when no value can be recovered yet.
+func CompletePartialJSON(text string) (string, bool) {
+	sc := &partialScanner{cutLen: -1}
+	sc.stack = append(sc.stack, partialFrame{state: expectValue})
+
+	i := 0
+	for i < len(text) {
+		c := text[i]
+		top := &sc.stack[len(sc.stack)-1]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"':
+			end, closed := scanString(text, i)
+			if !closed {
+				if top.state != expectValue {
+					return sc.cut(text)
+				}
+				candidate := trimPartialEscape(text[:end]) + `"` + closers(sc.stack[1:])
+				if json.Valid([]byte(candidate)) {
+					return candidate, true
+				}
+				return sc.cut(text)
+			}
+			i = end
+			if top.state == expectKey {
+				top.state = expectColon
+			} else {
+				top.state = afterValue
+				sc.mark(i)
+			}
+		case c == '{' || c == '[':
+			top.state = afterValue
+			sc.stack = append(sc.stack, partialFrame{object: c == '{', state: expectValue})
+			if c == '{' {
+				sc.stack[len(sc.stack)-1].state = expectKey
+			}
+			i++
+			sc.mark(i)
+		case c == '}' || c == ']':
+			if len(sc.stack) == 1 {
+				return sc.cut(text)
+			}
+			sc.stack = sc.stack[:len(sc.stack)-1]
+			i++
+			sc.mark(i)
+		case c == ':':
+			top.state = expectValue
+			i++
+		case c == ',':
+			if top.object {
+				top.state = expectKey
+			} else {
+				top.state = expectValue
+			}
+			i++
+		default:
+			end := i
+			for end < len(text) && strings.IndexByte("0123456789+-.eEtrufalsn", text[end]) >= 0 {
+				end++
+			}
+			if end == i || top.state != expectValue {
+				return sc.cut(text)
+			}
+			if end == len(text) {
+				// the literal or number may still be growing
+				candidate := text + closers(sc.stack[1:])
+				if json.Valid([]byte(candidate)) {
+					return candidate, true
+				}
+				return sc.cut(text)
+			}
+			if !json.Valid([]byte(text[i:end])) {
+				return sc.cut(text)
+			}
+			top.state = afterValue
+			i = end
+			sc.mark(i)
+		}
+	}
+	return sc.cut(text)
+}
+
+func (sc *partialScanner) mark(pos int) {
+	sc.cutLen = pos
+	sc.cutTail = append(sc.cutTail[:0], sc.stack[1:]...)
+}
+
+func (sc *partialScanner) cut(text string) (string, bool) {
+	if sc.cutLen < 0 {
+		return "", false
+	}
+	candidate := text[:sc.cutLen] + closers(sc.cutTail)
+	if !json.Valid([]byte(candidate)) {
+		return "", false
+	}
+	return candidate, true
+}
+
+// scanString returns the index after the closing quote of the string starting at
+// start, or len(text) if the string is unterminated.
+func scanString(text string, start int) (int, bool) {
+	escaped := false
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case text[i] == '\\':
+			escaped = true
+		case text[i] == '"':
+			return i + 1, true
+		}
+	}
+	return len(text), false
+}
+
+// trimPartialEscape removes an incomplete escape sequence at the end of a string body.
+func trimPartialEscape(text string) string {
+	idx := strings.LastIndexByte(text, '\\')
+	if idx < 0 {
+		return text
+	}
+	backslashes := 0
+	for j := idx; j >= 0 && text[j] == '\\'; j-- {
+		backslashes++
+	}
+	if backslashes%2 == 0 {
+		return text
+	}
+	tail := text[idx+1:]
+	if tail == "" || (tail[0] == 'u' && len(tail) < 5) {
+		return text[:idx]
+	}
+	return text
+}
+
+func closers(stack []partialFrame) string {
+	var sb strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].object {
+			sb.WriteByte('}')
+		} else {
+			sb.WriteByte(']')
+		}
+	}
+	return sb.String()
+}
+
+// partialJSONSource strips the prose and code fence around a JSON reply that is still
+// being streamed.
+func partialJSONSource(content string) string {
+	text := content
+	if block, ok := fencedBlock(text); ok {
+		text = block
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return ""
+	}
+	return text[start:]
+}
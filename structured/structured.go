@@ -2,7 +2,12 @@ package structured
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/bytedance/sonic"
 	"github.com/cloudwego/eino/components/model"
@@ -14,12 +19,22 @@ type PromptBuilder[TInput any] func(ctx context.Context, input TInput) ([]*schem
 
 type Chain[TInput, TOutput any] struct {
 	PromptBuilder PromptBuilder[TInput]
-	ChatModel     model.ToolCallingChatModel
+	ChatModel     model.BaseChatModel
 	ToolInfo      *schema.ToolInfo
+	// Strategy defaults to StrategyToolCall.
+	Strategy Strategy
+
+	// MaxAttempts is the number of times Invoke asks the model before giving up. After a
+	// response that cannot be parsed or fails Validator, the bad response and a
+	// corrective message are appended to the conversation and the model is asked again.
+	// Values below 1 mean a single attempt.
+	MaxAttempts int
+	// Validator optionally checks the parsed output; its error is fed back to the model.
+	Validator func(ctx context.Context, output *TOutput) error
 }
 
 func NewChain[TInput, TOutput any](
-	chatModel model.ToolCallingChatModel,
+	chatModel model.BaseChatModel,
 	promptBuilder PromptBuilder[TInput],
 	toolName string,
 	toolDesc string,
@@ -33,64 +48,211 @@ func NewChain[TInput, TOutput any](
 		PromptBuilder: promptBuilder,
 		ChatModel:     chatModel,
 		ToolInfo:      toolInfo,
+		Strategy:      StrategyToolCall,
 	}, nil
 }
 
 func (s *Chain[TInput, TOutput]) Invoke(ctx context.Context, input TInput) (*TOutput, error) {
+	messages, err := s.buildMessages(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := max(s.MaxAttempts, 1)
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		response, err := s.ChatModel.Generate(ctx, messages, s.modelOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("call model failed: %w", err)
+		}
+		result, err := s.parseResponse(ctx, response)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if attempt < attempts {
+			slog.Debug("Retrying structured output", "tool", s.ToolInfo.Name, "attempt", attempt, "error", err)
+			messages = append(slices.Clip(messages), s.correctionMessages(response, err)...)
+		}
+	}
+	return nil, lastErr
+}
+
+func (s *Chain[TInput, TOutput]) buildMessages(ctx context.Context, input TInput) ([]*schema.Message, error) {
 	messages, err := s.PromptBuilder(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("build prompt failed: %w", err)
 	}
+	if s.Strategy == StrategyJSONPrompt {
+		return jsonPromptMessages(messages, s.ToolInfo)
+	}
+	return messages, nil
+}
 
-	response, err := s.ChatModel.Generate(ctx, messages,
+func (s *Chain[TInput, TOutput]) modelOptions() []model.Option {
+	if s.Strategy == StrategyJSONPrompt {
+		return nil
+	}
+	return []model.Option{
 		model.WithTools([]*schema.ToolInfo{s.ToolInfo}),
 		model.WithToolChoice(schema.ToolChoiceForced, s.ToolInfo.Name),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("call model failed: %w", err)
 	}
-	if len(response.ToolCalls) == 0 {
-		return nil, fmt.Errorf("no ToolCall found in model response: %s", response.Content)
+}
+
+func (s *Chain[TInput, TOutput]) parseResponse(ctx context.Context, response *schema.Message) (*TOutput, error) {
+	var arguments string
+	if s.Strategy == StrategyJSONPrompt {
+		text, err := ExtractJSON(response.Content)
+		if err != nil {
+			return nil, err
+		}
+		arguments = text
+	} else {
+		if len(response.ToolCalls) == 0 {
+			return nil, fmt.Errorf("no ToolCall found in model response: %s", response.Content)
+		}
+		arguments = response.ToolCalls[0].Function.Arguments
 	}
 
 	var result TOutput
-	if err := sonic.UnmarshalString(response.ToolCalls[0].Function.Arguments, &result); err != nil {
+	if err := sonic.UnmarshalString(arguments, &result); err != nil {
 		return nil, fmt.Errorf("parse ToolCall arguments failed: %w", err)
 	}
+	if s.Validator != nil {
+		if err := s.Validator(ctx, &result); err != nil {
+			return nil, fmt.Errorf("validate ToolCall arguments failed: %w", err)
+		}
+	}
 
 	return &result, nil
 }
 
+// correctionMessages answers a bad response so the model can try again. Tool calls are
+// answered with a tool result; a plain-text reply is answered with a user message.
+func (s *Chain[TInput, TOutput]) correctionMessages(response *schema.Message, cause error) []*schema.Message {
+	if s.Strategy == StrategyJSONPrompt {
+		return []*schema.Message{
+			schema.AssistantMessage(response.Content, nil),
+			schema.UserMessage(fmt.Sprintf(
+				"The previous response was invalid: %v\nReply again with a single JSON object in a ```json code block that matches the schema.",
+				cause,
+			)),
+		}
+	}
+	correction := fmt.Sprintf(
+		"The previous response was invalid: %v\nFix the problem and call the '%s' tool again with arguments that match its JSON schema.",
+		cause, s.ToolInfo.Name,
+	)
+	assistant := schema.AssistantMessage(response.Content, response.ToolCalls)
+	if len(response.ToolCalls) == 0 {
+		return []*schema.Message{assistant, schema.UserMessage(correction)}
+	}
+	out := []*schema.Message{assistant}
+	for _, call := range response.ToolCalls {
+		out = append(out, schema.ToolMessage(correction, call.ID, schema.WithToolName(call.Function.Name)))
+	}
+	return out
+}
+
+// Stream emits progressively more complete outputs while the model is still generating
+// them, parsed from the tool-call argument (or JSON reply) fragments received so far.
+// The last value before io.EOF is the complete output, which is also checked by
+// Validator. Partial values are never validated.
 func (s *Chain[TInput, TOutput]) Stream(ctx context.Context, input TInput) (*schema.StreamReader[*TOutput], error) {
-	messages, err := s.PromptBuilder(ctx, input)
+	messages, err := s.buildMessages(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("build prompt failed: %w", err)
+		return nil, err
 	}
 
-	streamReader, err := s.ChatModel.Stream(ctx, messages,
-		model.WithTools([]*schema.ToolInfo{s.ToolInfo}),
-		model.WithToolChoice(schema.ToolChoiceForced, s.ToolInfo.Name),
-	)
+	streamReader, err := s.ChatModel.Stream(ctx, messages, s.modelOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("call model failed: %w", err)
 	}
 
-	outputReader := schema.StreamReaderWithConvert(streamReader, func(msg *schema.Message) (*TOutput, error) {
-		if len(msg.ToolCalls) == 0 {
-			return nil, fmt.Errorf("no ToolCall found in model response: %s", msg.Content)
-		}
+	outputReader, writer := schema.Pipe[*TOutput](8)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				writer.Send(nil, fmt.Errorf("recover from panic: %v", e))
+			}
+			writer.Close()
+		}()
+		defer streamReader.Close()
 
-		var result TOutput
-		if err := sonic.UnmarshalString(msg.ToolCalls[0].Function.Arguments, &result); err != nil {
-			return nil, fmt.Errorf("parse ToolCall arguments failed: %w", err)
+		var (
+			chunks      []*schema.Message
+			accumulated strings.Builder
+			lastPartial string
+		)
+		for {
+			chunk, rErr := streamReader.Recv()
+			if errors.Is(rErr, io.EOF) {
+				break
+			}
+			if rErr != nil {
+				writer.Send(nil, fmt.Errorf("receive model stream failed: %w", rErr))
+				return
+			}
+			if chunk == nil {
+				continue
+			}
+			chunks = append(chunks, chunk)
+			accumulated.WriteString(s.streamDelta(chunk))
+
+			partial, ok := s.completePartial(accumulated.String())
+			if !ok || partial == lastPartial {
+				continue
+			}
+			lastPartial = partial
+			var value TOutput
+			if sonic.UnmarshalString(partial, &value) != nil {
+				continue
+			}
+			if closed := writer.Send(&value, nil); closed {
+				return
+			}
 		}
 
-		return &result, nil
-	})
+		if len(chunks) == 0 {
+			writer.Send(nil, errors.New("empty model stream"))
+			return
+		}
+		response, cErr := schema.ConcatMessages(chunks)
+		if cErr != nil {
+			writer.Send(nil, fmt.Errorf("concat model stream failed: %w", cErr))
+			return
+		}
+		writer.Send(s.parseResponse(ctx, response))
+	}()
 
 	return outputReader, nil
 }
 
+// streamDelta returns the structured output fragment carried by a stream chunk: the
+// arguments of the first tool call, or the text content in JSON prompt mode.
+func (s *Chain[TInput, TOutput]) streamDelta(chunk *schema.Message) string {
+	if s.Strategy == StrategyJSONPrompt {
+		return chunk.Content
+	}
+	var sb strings.Builder
+	for _, call := range chunk.ToolCalls {
+		if call.Index == nil || *call.Index == 0 {
+			sb.WriteString(call.Function.Arguments)
+		}
+	}
+	return sb.String()
+}
+
+func (s *Chain[TInput, TOutput]) completePartial(accumulated string) (string, bool) {
+	if s.Strategy == StrategyJSONPrompt {
+		accumulated = partialJSONSource(accumulated)
+	}
+	if strings.TrimSpace(accumulated) == "" {
+		return "", false
+	}
+	return CompletePartialJSON(accumulated)
+}
+
 func (s *Chain[TInput, TOutput]) GetToolInfo() *schema.ToolInfo {
 	return s.ToolInfo
 }
@@ -3,11 +3,15 @@ package structured
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 )
 
@@ -159,3 +163,212 @@ func TestChain_Invoke(t *testing.T) {
 	}
 
 }
+
+type scriptedModel struct {
+	responses []*schema.Message
+	chunks    []*schema.Message
+	inputs    [][]*schema.Message
+}
+
+func (m *scriptedModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.inputs = append(m.inputs, input)
+	if len(m.responses) == 0 {
+		return nil, fmt.Errorf("no scripted response left")
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func (m *scriptedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if m.chunks != nil {
+		m.inputs = append(m.inputs, input)
+		return schema.StreamReaderFromArray(m.chunks), nil
+	}
+	resp, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{resp}), nil
+}
+
+func (m *scriptedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func toolCallMessage(name, args string) *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       "call_" + name,
+		Type:     "function",
+		Function: schema.FunctionCall{Name: name, Arguments: args},
+	}})
+}
+
+func TestChain_InvokeRetry(t *testing.T) {
+	type output struct {
+		Rating int `json:"rating"`
+	}
+	chatModel := &scriptedModel{responses: []*schema.Message{
+		schema.AssistantMessage("I think it is a 7", nil),
+		toolCallMessage("rate", `{"rating": "seven"}`),
+		toolCallMessage("rate", `{"rating": 70}`),
+		toolCallMessage("rate", `{"rating": 7}`),
+	}}
+	chain, err := NewChain[string, output](chatModel, func(ctx context.Context, input string) ([]*schema.Message, error) {
+		return []*schema.Message{schema.UserMessage(input)}, nil
+	}, "rate", "rate the movie")
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+	chain.MaxAttempts = 4
+	chain.Validator = func(ctx context.Context, o *output) error {
+		if o.Rating > 10 {
+			return fmt.Errorf("rating must be at most 10")
+		}
+		return nil
+	}
+
+	result, err := chain.Invoke(context.Background(), "great movie")
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if result.Rating != 7 {
+		t.Fatalf("rating = %d, want 7", result.Rating)
+	}
+	last := chatModel.inputs[len(chatModel.inputs)-1]
+	if len(last) != 7 {
+		t.Fatalf("expected 7 messages in final attempt, got %d", len(last))
+	}
+	if last[2].Role != schema.User || last[4].Role != schema.Tool || last[4].ToolCallID != "call_rate" {
+		t.Fatalf("unexpected correction messages: %+v", last)
+	}
+
+	chatModel.responses = []*schema.Message{schema.AssistantMessage("no tool", nil)}
+	chain.MaxAttempts = 1
+	if _, err := chain.Invoke(context.Background(), "great movie"); err == nil {
+		t.Fatal("expected error without retries")
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	cases := map[string]string{
+		"```json\n{\"a\": [1, 2,], \"b\": \"x,}\",}\n```": `{"a": [1, 2], "b": "x,}"}`,
+		"Sure! Here it is: {\"a\": 1} hope it helps":      `{"a": 1}`,
+		"```\n{\"a\": {\"b\": 1,},}\n```\nextra":          `{"a": {"b": 1}}`,
+	}
+	for input, want := range cases {
+		got, err := ExtractJSON(input)
+		if err != nil {
+			t.Fatalf("ExtractJSON(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("ExtractJSON(%q) = %q, want %q", input, got, want)
+		}
+	}
+	if _, err := ExtractJSON("no json here"); err == nil {
+		t.Fatal("expected error when no JSON is present")
+	}
+}
+
+func TestChain_InvokeJSONPrompt(t *testing.T) {
+	type output struct {
+		Rating int `json:"rating"`
+	}
+	chatModel := &scriptedModel{responses: []*schema.Message{
+		schema.AssistantMessage("```json\n{\"rating\": 8,}\n```", nil),
+	}}
+	chain, err := NewChain[string, output](chatModel, func(ctx context.Context, input string) ([]*schema.Message, error) {
+		return []*schema.Message{schema.SystemMessage("rate movies"), schema.UserMessage(input)}, nil
+	}, "rate", "rate the movie")
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+	chain.Strategy = StrategyJSONPrompt
+
+	result, err := chain.Invoke(context.Background(), "great movie")
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if result.Rating != 8 {
+		t.Fatalf("rating = %d, want 8", result.Rating)
+	}
+	system := chatModel.inputs[0][0]
+	if system.Role != schema.System || !strings.Contains(system.Content, "rate movies") || !strings.Contains(system.Content, `"rating"`) {
+		t.Fatalf("schema instructions not added to system prompt: %q", system.Content)
+	}
+}
+
+func TestCompletePartialJSON(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{`{"ops": [{"op": "add", "path": "/ti`, `{"ops": [{"op": "add", "path": "/ti"}]}`, true},
+		{`{"ops": [{"op": "add", "pa`, `{"ops": [{"op": "add"}]}`, true},
+		{`{"ops": [{"op": "add", "path":`, `{"ops": [{"op": "add"}]}`, true},
+		{`{"amount": 12.`, `{}`, true},
+		{`{"amount": 12`, `{"amount": 12}`, true},
+		{`{"done": tr`, `{}`, true},
+		{`{"a": "x\`, `{"a": "x"}`, true},
+		{`{"a": [1, 2,`, `{"a": [1, 2]}`, true},
+		{`{"a": 1} trailing`, `{"a": 1}`, true},
+		{`  `, ``, false},
+	}
+	for _, c := range cases {
+		got, ok := CompletePartialJSON(c.input)
+		if ok != c.ok || got != c.want {
+			t.Errorf("CompletePartialJSON(%q) = %q, %v; want %q, %v", c.input, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestChain_StreamPartial(t *testing.T) {
+	type output struct {
+		Title  string `json:"title"`
+		Amount int    `json:"amount"`
+	}
+	index := 0
+	fragments := []string{`{"ti`, `tle": "Tax`, `i", "amo`, `unt": 4`, `2}`}
+	chunks := make([]*schema.Message, 0, len(fragments))
+	for i, f := range fragments {
+		call := schema.ToolCall{Index: &index, Function: schema.FunctionCall{Arguments: f}}
+		if i == 0 {
+			call.ID = "call_1"
+			call.Function.Name = "fill"
+		}
+		chunks = append(chunks, schema.AssistantMessage("", []schema.ToolCall{call}))
+	}
+	chatModel := &scriptedModel{chunks: chunks}
+	chain, err := NewChain[string, output](chatModel, func(ctx context.Context, input string) ([]*schema.Message, error) {
+		return []*schema.Message{schema.UserMessage(input)}, nil
+	}, "fill", "fill the form")
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+	stream, err := chain.Stream(context.Background(), "taxi 42")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	defer stream.Close()
+	var values []output
+	for {
+		v, rErr := stream.Recv()
+		if errors.Is(rErr, io.EOF) {
+			break
+		}
+		if rErr != nil {
+			t.Fatalf("Recv failed: %v", rErr)
+		}
+		values = append(values, *v)
+	}
+	if len(values) < 3 {
+		t.Fatalf("expected progressive values, got %+v", values)
+	}
+	if values[1].Title != "Tax" {
+		t.Fatalf("expected partial title, got %+v", values)
+	}
+	if last := values[len(values)-1]; last.Title != "Taxi" || last.Amount != 42 {
+		t.Fatalf("unexpected final value %+v", last)
+	}
+}
@@ -0,0 +1,87 @@
+package testcases
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/patch"
+	"github.com/tbxark/formagent/spec"
+)
+
+// Minimum scores of DefaultUpdateFormSystemPromptTemplate on patches/expense.jsonl.
+const (
+	minExactMatchRate = 0.75
+	maxInvalidOpRate  = 0.1
+)
+
+// TestPatchEval scores DefaultUpdateFormSystemPromptTemplate against the thresholds
+// above when a live model or a recorded cassette answers. The offline script replies
+// with the expected ops, so without either it only checks that the evaluation runs.
+// With a live model it also compares the template in FORMAGENT_CANDIDATE_PROMPT.
+func TestPatchEval(t *testing.T) {
+	cases, err := formagenttest.LoadPatchCases[*expenseForm](filepath.Join("patches", "expense.jsonl"))
+	if err != nil {
+		t.Fatalf("加载数据集失败: %v", err)
+	}
+	cm, source := chatModel(t, filepath.Join("cassettes", "patch_eval.jsonl"), func(m *formagenttest.FakeChatModel) {
+		for _, c := range cases {
+			args, err := json.Marshal(&patch.UpdateFormArgs{Ops: append([]patch.Operation{}, c.ExpectedOps...)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := c.Messages[len(c.Messages)-1].Content
+			m.OnTool("update_form").WhenUserSays(last).ReplyToolCall(string(args))
+		}
+	})
+	formSpec, err := spec.NewTagSpec[*expenseForm](spec.WithTitle("报销单"))
+	if err != nil {
+		t.Fatalf("创建表单失败: %v", err)
+	}
+	evaluator := &formagenttest.PatchEvaluator[*expenseForm]{
+		Spec:      formSpec,
+		Validator: patch.NewSchemaValidatorFor[expenseForm](),
+	}
+	ctx := context.Background()
+
+	baseline, err := patch.NewToolBasedPatchGenerator[*expenseForm](cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := evaluator.Evaluate(ctx, "default", baseline, cases)
+	results := []*formagenttest.PatchEvalResult{result}
+
+	if path := os.Getenv("FORMAGENT_CANDIDATE_PROMPT"); path != "" {
+		if source != liveModel {
+			t.Log("跳过候选 prompt 对比：需要真实模型")
+		} else {
+			prompt, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取候选 prompt 失败: %v", err)
+			}
+			candidate, err := patch.NewToolBasedPatchGenerator[*expenseForm](cm, patch.WithPatchSystemPromptTemplate[*expenseForm](string(prompt)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, evaluator.Evaluate(ctx, filepath.Base(path), candidate, cases))
+		}
+	}
+	t.Log("\n" + formagenttest.ComparePatchEvals(results...))
+	if source == scriptedModel {
+		t.Log("跳过阈值检查：没有真实模型或 cassette，脚本只会返回预期的操作")
+		return
+	}
+
+	if rate := result.ErrorRate(); rate > 0 {
+		t.Errorf("default prompt error rate = %.2f, want 0", rate)
+	}
+	if rate := result.ExactMatchRate(); rate < minExactMatchRate {
+		t.Errorf("default prompt exact match rate = %.2f, want >= %.2f", rate, minExactMatchRate)
+	}
+	if rate := result.InvalidOpRate(); rate > maxInvalidOpRate {
+		t.Errorf("default prompt invalid op rate = %.2f, want <= %.2f", rate, maxInvalidOpRate)
+	}
+}
@@ -0,0 +1,140 @@
+package testcases
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/tbxark/formagent/agent"
+	"github.com/tbxark/formagent/formagenttest"
+	"github.com/tbxark/formagent/spec"
+)
+
+type expenseItem struct {
+	Name   string  `json:"name" jsonschema:"description=费用名称" form:"required,label=名称"`
+	Amount float64 `json:"amount" jsonschema:"description=金额（元）" form:"required,label=金额,min=0"`
+}
+
+type expenseForm struct {
+	Title string        `json:"title,omitempty" jsonschema:"description=报销抬头" form:"required,label=抬头"`
+	Items []expenseItem `json:"items,omitempty" jsonschema:"description=费用明细" form:"required,label=明细,minlen=1"`
+}
+
+// modelSource tells which kind of model chatModel returned.
+type modelSource int
+
+const (
+	scriptedModel modelSource = iota
+	cassetteModel
+	liveModel
+)
+
+// chatModel returns a live model when FORMAGENT_RUN_LIVE_TESTS and OPENAI_API_KEY are
+// set, recording the session to cassette if FORMAGENT_RECORD_CASSETTES is also set.
+// Otherwise it replays the recorded cassette, or falls back to a fake model set up by
+// script so the test still runs offline.
+func chatModel(t *testing.T, cassette string, script func(m *formagenttest.FakeChatModel)) (model.ToolCallingChatModel, modelSource) {
+	t.Helper()
+	openaiApiKey := os.Getenv("OPENAI_API_KEY")
+	if os.Getenv("FORMAGENT_RUN_LIVE_TESTS") == "" || openaiApiKey == "" {
+		if _, err := os.Stat(cassette); err != nil {
+			fake := formagenttest.NewFakeChatModel()
+			script(fake)
+			return fake, scriptedModel
+		}
+		replay, err := formagenttest.NewReplayer(cassette)
+		if err != nil {
+			t.Fatalf("加载 cassette 失败: %v", err)
+		}
+		return replay, cassetteModel
+	}
+
+	openaiModel := os.Getenv("OPENAI_MODEL")
+	if openaiModel == "" {
+		openaiModel = "gpt-4o"
+	}
+	baseUrl := os.Getenv("OPENAI_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "https://api.openai.com/v1"
+	}
+	openaiCM, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
+		APIKey:  openaiApiKey,
+		Model:   openaiModel,
+		BaseURL: baseUrl,
+	})
+	if err != nil {
+		t.Fatalf("创建 ChatModel 失败: %v", err)
+	}
+	if os.Getenv("FORMAGENT_RECORD_CASSETTES") == "" {
+		return openaiCM, liveModel
+	}
+	if err := os.MkdirAll(filepath.Dir(cassette), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := formagenttest.NewRecorder(openaiCM, cassette)
+	if err != nil {
+		t.Fatalf("创建 cassette 失败: %v", err)
+	}
+	t.Cleanup(func() { _ = rec.Close() })
+	return rec, liveModel
+}
+
+// scenarioScripts answer each scenario offline. The flow renders the whole history
+// into the prompt, so the rule for the latest turn comes first.
+var scenarioScripts = map[string]func(m *formagenttest.FakeChatModel){
+	"expense_confirm": func(m *formagenttest.FakeChatModel) {
+		m.OnTool("parse_intent").WhenUserSays("确认提交").ReplyToolCall(`{"intent":"confirm"}`)
+		m.OnTool("parse_intent").WhenUserSays("就这些").ReplyToolCall(`{"intent":"confirm"}`)
+		m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+		m.OnTool("update_form").WhenUserSays("上海出差").
+			ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"上海出差"}]}`)
+		m.OnTool("update_form").
+			ReplyToolCall(`{"ops":[{"op":"add","path":"/items","value":[{"name":"打车","amount":42}]}]}`)
+		m.OnText().ReplyText("好的，已记录。")
+	},
+	"expense_undo": func(m *formagenttest.FakeChatModel) {
+		m.OnTool("parse_intent").WhenUserSays("不报了").ReplyToolCall(`{"intent":"cancel"}`)
+		m.OnTool("parse_intent").WhenUserSays("撤回").ReplyToolCall(`{"intent":"undo"}`)
+		m.OnTool("parse_intent").ReplyToolCall(`{"intent":"edit"}`)
+		m.OnTool("update_form").ReplyToolCall(`{"ops":[{"op":"add","path":"/title","value":"北京出差"}]}`)
+		m.OnText().ReplyText("好的。")
+	},
+}
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := formagenttest.LoadScenarios("scenarios")
+	if err != nil {
+		t.Fatalf("加载场景失败: %v", err)
+	}
+	formSpec, err := spec.NewTagSpec[*expenseForm](spec.WithTitle("报销单"))
+	if err != nil {
+		t.Fatalf("创建表单失败: %v", err)
+	}
+	for _, sc := range scenarios {
+		t.Run(sc.Name, func(t *testing.T) {
+			t.Parallel()
+			script, ok := scenarioScripts[sc.Name]
+			if !ok {
+				t.Fatalf("场景 %s 没有离线脚本", sc.Name)
+			}
+			cm, _ := chatModel(t, filepath.Join("cassettes", sc.Name+".jsonl"), script)
+			flow, err := agent.NewToolBasedFormFlow[*expenseForm](formSpec, cm)
+			if err != nil {
+				t.Fatalf("创建 FormFlow 失败: %v", err)
+			}
+			flow.Submitter = agent.SubmitterFunc[*expenseForm](func(ctx context.Context, form *expenseForm) (*agent.Receipt, error) {
+				return &agent.Receipt{ID: "TEST-" + sc.Name}, nil
+			})
+			report := &formagenttest.Report{Scenarios: []*formagenttest.ScenarioResult{
+				formagenttest.RunScenario(context.Background(), flow, sc),
+			}}
+			if !report.Passed() {
+				t.Fatalf("场景未通过:\n%s", report)
+			}
+			t.Log(report)
+		})
+	}
+}
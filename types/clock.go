@@ -0,0 +1,36 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Clock returns the current time. Setting one on a ToolRequest pins the date shown to
+// the model.
+type Clock func() time.Time
+
+// FixedClock returns a Clock that always reports t.
+func FixedClock(t time.Time) Clock {
+	return func() time.Time {
+		return t
+	}
+}
+
+type locationKey struct{}
+
+// WithLocation attaches the user's time zone to ctx. FormFlow copies it onto the
+// ToolRequest so relative dates such as "yesterday" resolve in the user's zone.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+func LocationFromContext(ctx context.Context) (*time.Location, bool) {
+	loc, ok := ctx.Value(locationKey{}).(*time.Location)
+	return loc, ok && loc != nil
+}
+
+// FormatCurrentDate renders t with its weekday and time zone name for prompts.
+func FormatCurrentDate(t time.Time) string {
+	return fmt.Sprintf("%s (%s, %s)", t.Format(time.RFC3339), t.Weekday(), t.Location())
+}
@@ -1,10 +1,10 @@
 package types
 
 import (
-	"fmt"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/cloudwego/eino/schema"
 )
@@ -64,10 +64,41 @@ func FormatValidationErrorsSection(errors []FieldInfo) string {
 	return buf.String()
 }
 
+// FormatExtraSection lists the string values of a request's Extra, such as the notes the
+// flow leaves for the dialogue after an undo or a reset. Other values are skipped.
+func FormatExtraSection(extra map[string]any) string {
+	var buf strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(extra)) {
+		note, ok := extra[key].(string)
+		if !ok || note == "" {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteString("# Notes:\n")
+		}
+		buf.WriteString("- ")
+		buf.WriteString(key)
+		buf.WriteString(": ")
+		buf.WriteString(note)
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// FormatMessageHistory renders history summaries, earlier messages and the latest user
+// message as separate sections.
 func FormatMessageHistory(messages []*schema.Message) string {
 	if len(messages) == 0 {
 		return ""
 	}
+	summaries, messages := SplitHistorySummary(messages)
+	var summary strings.Builder
+	for _, msg := range summaries {
+		if summary.Len() > 0 {
+			summary.WriteString("\n")
+		}
+		summary.WriteString(msg.Content)
+	}
 	lastUserIndex := -1
 	for i := len(messages) - 1; i >= 0; i-- {
 		if string(messages[i].Role) == "user" {
@@ -95,7 +126,15 @@ func FormatMessageHistory(messages []*schema.Message) string {
 		history.WriteString("\n")
 	}
 	var buf strings.Builder
+	if summary.Len() > 0 {
+		buf.WriteString("# Summary of earlier conversation:\n")
+		buf.WriteString(WrapMarkdownCodeBlock(summary.String(), ""))
+		buf.WriteString("\n")
+	}
 	if history.Len() > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
 		buf.WriteString("# Dialogue history:\n")
 		buf.WriteString(history.String())
 	}
@@ -114,26 +153,10 @@ func FormatMessageHistory(messages []*schema.Message) string {
 	return buf.String()
 }
 
+// FormatToolRequest renders req with the default prompt sections. Use PromptRenderer to
+// change the sections or their order.
 func FormatToolRequest[T any](req *ToolRequest[T]) (string, error) {
-	sections := []string{
-		fmt.Sprintf("# Current Date: \n %s", time.Now().Format(time.RFC3339)),
-	}
-	if req.StateSummary != "" {
-		sections = append(sections, fmt.Sprintf("# Form state:\n%s", req.StateSummary))
-	}
-	if req.Phase != "" {
-		sections = append(sections, fmt.Sprintf("# Current Phase:\n**%s**", req.Phase))
-	}
-	if s := FormatMessageHistory(req.Messages); s != "" {
-		sections = append(sections, s)
-	}
-	if s := FormatMissingFieldsSectionForDialogue(req.MissingFields); s != "" {
-		sections = append(sections, s)
-	}
-	if s := FormatValidationErrorsSection(req.ValidationErrors); s != "" {
-		sections = append(sections, s)
-	}
-	return strings.Join(sections, "\n\n"), nil
+	return DefaultPromptRenderer[T]().Render(req)
 }
 
 func WrapMarkdownCodeBlock(text, lang string) string {
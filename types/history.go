@@ -0,0 +1,155 @@
+package types
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// HistorySummaryKey marks, in schema.Message.Extra, a system message that summarizes
+// earlier turns of the conversation.
+const HistorySummaryKey = "formagent_history_summary"
+
+// NewHistorySummary returns the message that stands in for summarized turns.
+func NewHistorySummary(summary string) *schema.Message {
+	msg := schema.SystemMessage(summary)
+	msg.Extra = map[string]any{HistorySummaryKey: true}
+	return msg
+}
+
+func IsHistorySummary(msg *schema.Message) bool {
+	if msg == nil || msg.Role != schema.System {
+		return false
+	}
+	marked, _ := msg.Extra[HistorySummaryKey].(bool)
+	return marked
+}
+
+// SplitHistorySummary separates summary messages from the rest of the history.
+func SplitHistorySummary(messages []*schema.Message) (summaries, rest []*schema.Message) {
+	for _, msg := range messages {
+		if IsHistorySummary(msg) {
+			summaries = append(summaries, msg)
+		} else {
+			rest = append(rest, msg)
+		}
+	}
+	return summaries, rest
+}
+
+// TokenEstimator returns the approximate number of tokens in text.
+type TokenEstimator func(text string) int
+
+// EstimateTokens is a rough tokenizer-free estimate: about four ASCII characters per
+// token and one token per other character, which overestimates for most CJK models.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// messageOverhead approximates the role header and code fence FormatMessageHistory adds.
+const messageOverhead = 8
+
+// HistoryPolicy limits how much chat history is rendered into a prompt. Zero values
+// mean no limit. The latest user message is always kept, even when it alone exceeds
+// MaxTokens, and history summaries are always kept without counting against the limits.
+type HistoryPolicy struct {
+	// MaxTurns keeps the messages from the MaxTurns-th last user message onward.
+	MaxTurns int
+	// MaxTokens drops the oldest messages until the history fits the budget.
+	MaxTokens int
+	// Estimator counts tokens for MaxTokens; defaults to EstimateTokens.
+	Estimator TokenEstimator
+}
+
+// Apply returns the most recent messages allowed by the policy, in their original order.
+func (p *HistoryPolicy) Apply(messages []*schema.Message) []*schema.Message {
+	if p == nil || len(messages) == 0 {
+		return messages
+	}
+	summaries, messages := SplitHistorySummary(messages)
+	if len(summaries) == 0 {
+		return p.apply(messages)
+	}
+	return append(summaries, p.apply(messages)...)
+}
+
+func (p *HistoryPolicy) apply(messages []*schema.Message) []*schema.Message {
+	if len(messages) == 0 {
+		return messages
+	}
+	lastUser := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == schema.User {
+			lastUser = i
+			break
+		}
+	}
+
+	start := 0
+	if p.MaxTurns > 0 {
+		turns := 0
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role != schema.User {
+				continue
+			}
+			turns++
+			if turns == p.MaxTurns {
+				start = i
+				break
+			}
+		}
+	}
+
+	if p.MaxTokens > 0 {
+		estimate := p.Estimator
+		if estimate == nil {
+			estimate = EstimateTokens
+		}
+		used := 0
+		if lastUser >= start {
+			used = estimate(messages[lastUser].Content) + messageOverhead
+		}
+		budgetStart := len(messages)
+		for i := len(messages) - 1; i >= start; i-- {
+			if i != lastUser {
+				used += estimate(messages[i].Content) + messageOverhead
+				if used > p.MaxTokens {
+					break
+				}
+			}
+			budgetStart = i
+		}
+		start = budgetStart
+	}
+
+	if lastUser >= 0 && lastUser < start {
+		// the latest user message is older than the kept window, e.g. when the history
+		// ends with several assistant messages
+		kept := make([]*schema.Message, 0, len(messages)-start+1)
+		kept = append(kept, messages[lastUser])
+		return append(kept, messages[start:]...)
+	}
+	return messages[start:]
+}
+
+// LimitHistory wraps a prompt builder so it only sees the history allowed by policy.
+// The request itself is not modified.
+func LimitHistory[T any](policy *HistoryPolicy, build func(ctx context.Context, req *ToolRequest[T]) ([]*schema.Message, error)) func(ctx context.Context, req *ToolRequest[T]) ([]*schema.Message, error) {
+	if policy == nil {
+		return build
+	}
+	return func(ctx context.Context, req *ToolRequest[T]) ([]*schema.Message, error) {
+		limited := *req
+		limited.Messages = policy.Apply(req.Messages)
+		return build(ctx, &limited)
+	}
+}
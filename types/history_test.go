@@ -0,0 +1,62 @@
+package types
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func contents(messages []*schema.Message) string {
+	parts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		parts = append(parts, m.Content)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestHistoryPolicy_Apply(t *testing.T) {
+	history := []*schema.Message{
+		schema.UserMessage("u1"),
+		schema.AssistantMessage("a1", nil),
+		schema.UserMessage("u2"),
+		schema.AssistantMessage("a2", nil),
+		schema.UserMessage(strings.Repeat("长", 40)),
+	}
+	tests := []struct {
+		name   string
+		policy *HistoryPolicy
+		want   string
+	}{
+		{"unlimited", nil, contents(history)},
+		{"last two turns", &HistoryPolicy{MaxTurns: 2}, "u2,a2," + history[4].Content},
+		{"budget keeps latest user message only", &HistoryPolicy{MaxTokens: 10}, history[4].Content},
+		{"budget", &HistoryPolicy{MaxTokens: 48 + 18}, "u2,a2," + history[4].Content},
+		{"turns and budget", &HistoryPolicy{MaxTurns: 1, MaxTokens: 1000}, history[4].Content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contents(tt.policy.Apply(history)); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	trailing := append(history[:3:3], schema.AssistantMessage("a3", nil), schema.AssistantMessage("a4", nil))
+	if got := contents((&HistoryPolicy{MaxTokens: 9 + 9 + 5}).Apply(trailing)); got != "u2,a4" {
+		t.Fatalf("latest user message should be kept before the window, got %q", got)
+	}
+}
+
+func TestLimitHistory(t *testing.T) {
+	req := &ToolRequest[any]{Messages: []*schema.Message{schema.UserMessage("u1"), schema.UserMessage("u2")}}
+	build := LimitHistory(&HistoryPolicy{MaxTurns: 1}, DefaultPromptRenderer[any]().PromptBuilder("system"))
+	messages, err := build(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(messages[1].Content, "u1") || len(req.Messages) != 2 {
+		t.Fatalf("history not limited or request modified: %q", messages[1].Content)
+	}
+}
@@ -0,0 +1,166 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Names of the sections rendered by the default PromptRenderer.
+const (
+	SectionDate             = "date"
+	SectionState            = "state"
+	SectionPhase            = "phase"
+	SectionHistory          = "history"
+	SectionMissingFields    = "missing_fields"
+	SectionValidationErrors = "validation_errors"
+	SectionExtra            = "extra"
+)
+
+// DefaultSectionOrder is the order in which the default sections are rendered.
+var DefaultSectionOrder = []string{
+	SectionDate,
+	SectionState,
+	SectionPhase,
+	SectionHistory,
+	SectionMissingFields,
+	SectionValidationErrors,
+	SectionExtra,
+}
+
+// DefaultSectionTemplates are the text/template sources of the default sections. The
+// extra section lists the string values of ToolRequest.Extra.
+var DefaultSectionTemplates = map[string]string{
+	SectionDate:             "# Current Date: \n {{ date .Now }}",
+	SectionState:            "{{ if .StateSummary }}# Form state:\n{{ .StateSummary }}{{ end }}",
+	SectionPhase:            "{{ if .Phase }}# Current Phase:\n**{{ .Phase }}**{{ end }}",
+	SectionHistory:          "{{ history .Messages }}",
+	SectionMissingFields:    "{{ missingFields .MissingFields }}",
+	SectionValidationErrors: "{{ validationErrors .ValidationErrors }}",
+	SectionExtra:            "{{ extra .Extra }}",
+}
+
+// PromptFuncs are the functions available to section templates.
+var PromptFuncs = template.FuncMap{
+	"date":             FormatCurrentDate,
+	"history":          FormatMessageHistory,
+	"missingFields":    FormatMissingFieldsSectionForDialogue,
+	"validationErrors": FormatValidationErrorsSection,
+	"extra":            FormatExtraSection,
+	"codeblock":        WrapMarkdownCodeBlock,
+	"json": func(v any) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
+var defaultSections = mustParseSections(DefaultSectionTemplates)
+
+type promptRendererOptions struct {
+	order     []string
+	overrides map[string]string
+}
+
+type PromptRendererOption func(*promptRendererOptions)
+
+// WithPromptSection replaces the template of a section, or adds a new section after
+// the existing ones. An empty template removes the section from the output.
+func WithPromptSection(name, text string) PromptRendererOption {
+	return func(o *promptRendererOptions) {
+		if o.overrides == nil {
+			o.overrides = make(map[string]string)
+		}
+		o.overrides[name] = text
+		if !slices.Contains(o.order, name) {
+			o.order = append(o.order, name)
+		}
+	}
+}
+
+// WithPromptSectionOrder sets which sections are rendered and in what order.
+func WithPromptSectionOrder(names ...string) PromptRendererOption {
+	return func(o *promptRendererOptions) {
+		o.order = slices.Clone(names)
+	}
+}
+
+// PromptRenderer renders a ToolRequest as the user prompt of a generator. Each section
+// is a text/template executed with the *ToolRequest[T] as data; sections that render
+// only whitespace are skipped and the rest are joined with blank lines.
+type PromptRenderer[T any] struct {
+	order    []string
+	sections map[string]*template.Template
+}
+
+// DefaultPromptRenderer renders the same prompt as FormatToolRequest.
+func DefaultPromptRenderer[T any]() *PromptRenderer[T] {
+	return &PromptRenderer[T]{order: DefaultSectionOrder, sections: defaultSections}
+}
+
+func NewPromptRenderer[T any](opts ...PromptRendererOption) (*PromptRenderer[T], error) {
+	options := &promptRendererOptions{order: slices.Clone(DefaultSectionOrder)}
+	for _, opt := range opts {
+		opt(options)
+	}
+	sections := make(map[string]*template.Template, len(defaultSections)+len(options.overrides))
+	for name, tmpl := range defaultSections {
+		sections[name] = tmpl
+	}
+	for name, text := range options.overrides {
+		tmpl, err := template.New(name).Funcs(PromptFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt section %q: %w", name, err)
+		}
+		sections[name] = tmpl
+	}
+	for _, name := range options.order {
+		if _, ok := sections[name]; !ok {
+			return nil, fmt.Errorf("prompt section %q has no template", name)
+		}
+	}
+	return &PromptRenderer[T]{order: options.order, sections: sections}, nil
+}
+
+func (r *PromptRenderer[T]) Render(req *ToolRequest[T]) (string, error) {
+	parts := make([]string, 0, len(r.order))
+	var buf strings.Builder
+	for _, name := range r.order {
+		buf.Reset()
+		if err := r.sections[name].Execute(&buf, req); err != nil {
+			return "", fmt.Errorf("failed to render prompt section %q: %w", name, err)
+		}
+		if strings.TrimSpace(buf.String()) == "" {
+			continue
+		}
+		parts = append(parts, buf.String())
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// PromptBuilder sends systemPrompt followed by the rendered request as a user message.
+// Its signature matches the PromptBuilder types of the generator packages.
+func (r *PromptRenderer[T]) PromptBuilder(systemPrompt string) func(ctx context.Context, req *ToolRequest[T]) ([]*schema.Message, error) {
+	return func(ctx context.Context, req *ToolRequest[T]) ([]*schema.Message, error) {
+		message, err := r.Render(req)
+		if err != nil {
+			return nil, fmt.Errorf("convert to prompt message failed: %w", err)
+		}
+		return []*schema.Message{
+			schema.SystemMessage(systemPrompt),
+			schema.UserMessage(message),
+		}, nil
+	}
+}
+
+func mustParseSections(sources map[string]string) map[string]*template.Template {
+	sections := make(map[string]*template.Template, len(sources))
+	for name, text := range sources {
+		sections[name] = template.Must(template.New(name).Funcs(PromptFuncs).Parse(text))
+	}
+	return sections
+}
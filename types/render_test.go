@@ -0,0 +1,67 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func testRequest() *ToolRequest[map[string]any] {
+	return &ToolRequest[map[string]any]{
+		Clock:        FixedClock(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)),
+		StateSummary: "title: A",
+		Phase:        PhaseCollecting,
+		Messages: []*schema.Message{
+			schema.AssistantMessage("金额是多少？", nil),
+			schema.UserMessage("42"),
+		},
+		MissingFields: []FieldInfo{{JSONPointer: "/amount", DisplayName: "金额"}},
+		Extra:         map[string]any{"ops": 1, "undo": "nothing to undo"},
+	}
+}
+
+func TestFormatToolRequest(t *testing.T) {
+	got, err := FormatToolRequest(testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Current Date: \n 2025-01-02T03:04:05Z (Thursday, UTC)\n\n" +
+		"# Form state:\ntitle: A\n\n" +
+		"# Current Phase:\n**collecting**\n\n" +
+		"# Dialogue history:\n#### assistant: \n```\n金额是多少？\n```\n\n" +
+		"# Latest user message:\n```\n42\n```\n\n" +
+		"# Missing required fields:\n- 金额 (`/amount`)\n\n\n" +
+		"# Notes:\n- undo: nothing to undo\n"
+	if got != want {
+		t.Fatalf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestPromptRenderer_Sections(t *testing.T) {
+	r, err := NewPromptRenderer[map[string]any](
+		WithPromptSection(SectionState, "## 当前表单\n{{ .StateSummary }}"),
+		WithPromptSection(SectionExtra, "{{ with .Extra }}## Extra\n{{ json . }}{{ end }}"),
+		WithPromptSection("rules", "## Rules\n- be brief"),
+		WithPromptSectionOrder("rules", SectionState, SectionExtra),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Render(testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Rules\n- be brief\n\n## 当前表单\ntitle: A\n\n## Extra\n{\n  \"ops\": 1,\n  \"undo\": \"nothing to undo\"\n}"
+	if got != want {
+		t.Fatalf("got:\n%q", got)
+	}
+
+	if _, err := NewPromptRenderer[any](WithPromptSection("bad", "{{ .Missing")); err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+	if _, err := NewPromptRenderer[any](WithPromptSectionOrder("unknown")); err == nil {
+		t.Fatal("expected unknown section error")
+	}
+}
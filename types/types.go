@@ -1,13 +1,23 @@
 package types
 
-import "github.com/cloudwego/eino/schema"
+import (
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
 
 type Phase string
 
 const (
-	PhaseCollecting Phase = "collecting"
-	PhaseConfirmed  Phase = "confirmed"
-	PhaseCancelled  Phase = "cancelled"
+	PhaseCollecting   Phase = "collecting"
+	PhaseConfirming   Phase = "confirming"
+	PhaseSubmitted    Phase = "submitted"
+	PhaseSubmitFailed Phase = "submit_failed"
+	PhaseCancelled    Phase = "cancelled"
+
+	// Deprecated: PhaseConfirmed was the terminal phase of a confirmed form before
+	// confirmation and submission were split. StateStore loads it as PhaseSubmitted.
+	PhaseConfirmed Phase = "confirmed"
 )
 
 type FieldInfo struct {
@@ -27,4 +37,22 @@ type ToolRequest[T any] struct {
 	MissingFields    []FieldInfo
 	ValidationErrors []FieldInfo
 	Extra            map[string]any
+
+	// Clock and Location control the current date shown in prompts; nil means
+	// time.Now and the clock's own location.
+	Clock    Clock
+	Location *time.Location
+}
+
+// Now returns the request's current time in its location.
+func (r *ToolRequest[T]) Now() time.Time {
+	now := time.Now
+	if r.Clock != nil {
+		now = r.Clock
+	}
+	t := now()
+	if r.Location != nil {
+		t = t.In(r.Location)
+	}
+	return t
 }